@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/meow-io/go-slick v0.0.0-20230706215057-8273968b729a
+	github.com/meow-io/go-sqlcipher v1.0.2
 	github.com/rivo/uniseg v0.4.4
 	github.com/stretchr/testify v1.8.4
 	go.uber.org/zap v1.24.0
@@ -25,7 +26,6 @@ require (
 	github.com/joshbuddy/jpake v0.0.0-20230530080604-b04d6e53e4e4 // indirect
 	github.com/kevinburke/nacl v0.0.0-20210405173606-cd9060f5f776 // indirect
 	github.com/mattn/go-sqlite3 v1.14.9 // indirect
-	github.com/meow-io/go-sqlcipher v1.0.2 // indirect
 	github.com/meow-io/heya v0.0.0-20230606080709-8b8c7378db5b // indirect
 	github.com/miekg/dns v1.1.55 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -0,0 +1,204 @@
+package roost
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	freqDaily = iota
+	freqWeekly
+	freqMonthly
+	freqYearly
+
+	// The number of periods searched for a next occurrence before giving up. This bounds rules such as
+	// FREQ=MONTHLY;BYMONTHDAY=31;INTERVAL=2 which can go a long time without matching.
+	maxRecurrencePeriods = 1000
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// A recurrence rule for a todo. This supports a subset of RFC 5545 RRULEs, namely FREQ (DAILY, WEEKLY, MONTHLY
+// or YEARLY), INTERVAL, BYDAY (for daily and weekly rules), BYMONTHDAY (for monthly rules) and UNTIL. For example
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH".
+type recurrence struct {
+	freq       int
+	interval   int
+	byDay      []time.Weekday
+	byMonthDay []int
+	until      time.Time
+}
+
+func parseRecurrence(rule string) (*recurrence, error) {
+	rc := &recurrence{freq: -1, interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(rule), "RRULE:"), ";") {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("expected name=value, got %q", part)
+		}
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY":
+				rc.freq = freqDaily
+			case "WEEKLY":
+				rc.freq = freqWeekly
+			case "MONTHLY":
+				rc.freq = freqMonthly
+			case "YEARLY":
+				rc.freq = freqYearly
+			default:
+				return nil, fmt.Errorf("unsupported frequency %s", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			if interval < 1 {
+				return nil, fmt.Errorf("expected interval of at least 1, got %d", interval)
+			}
+			rc.interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unsupported day %s", day)
+				}
+				rc.byDay = append(rc.byDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil {
+					return nil, err
+				}
+				if monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return nil, fmt.Errorf("expected month day between -31 and 31, got %d", monthDay)
+				}
+				rc.byMonthDay = append(rc.byMonthDay, monthDay)
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rc.until = until
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+	}
+	if rc.freq == -1 {
+		return nil, errors.New("expected FREQ to be specified")
+	}
+	if len(rc.byDay) != 0 && rc.freq != freqDaily && rc.freq != freqWeekly {
+		return nil, errors.New("BYDAY is only supported for daily and weekly rules")
+	}
+	if len(rc.byMonthDay) != 0 && rc.freq != freqMonthly {
+		return nil, errors.New("BYMONTHDAY is only supported for monthly rules")
+	}
+	return rc, nil
+}
+
+// Parses an UNTIL value. A date without a time includes the whole of that day.
+func parseUntil(value string) (time.Time, error) {
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case strings.Contains(value, "T"):
+		return time.ParseInLocation("20060102T150405", value, time.Local)
+	default:
+		day, err := time.ParseInLocation("20060102", value, time.Local)
+		if err != nil {
+			return day, err
+		}
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+}
+
+// Gets the first occurrence strictly after the given time, keeping its time of day. Returns false if the rule
+// has no further occurrences.
+func (rc *recurrence) next(after time.Time) (time.Time, bool) {
+	for period := 0; period != maxRecurrencePeriods; period++ {
+		for _, candidate := range rc.candidates(after, period) {
+			if !candidate.After(after) {
+				continue
+			}
+			if !rc.until.IsZero() && candidate.After(rc.until) {
+				return time.Time{}, false
+			}
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Gets the occurrences, in order, within the given period counting from the period containing start.
+func (rc *recurrence) candidates(start time.Time, period int) []time.Time {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	}
+
+	switch rc.freq {
+	case freqDaily:
+		day := date(start.Year(), start.Month(), start.Day()+period*rc.interval)
+		if len(rc.byDay) == 0 || slices.Contains(rc.byDay, day.Weekday()) {
+			return []time.Time{day}
+		}
+		return nil
+	case freqWeekly:
+		if len(rc.byDay) == 0 {
+			return []time.Time{date(start.Year(), start.Month(), start.Day()+period*rc.interval*7)}
+		}
+		// weeks start on monday
+		monday := start.Day() - (int(start.Weekday())+6)%7 + period*rc.interval*7
+		days := make([]time.Time, 0, len(rc.byDay))
+		for _, weekday := range rc.byDay {
+			days = append(days, date(start.Year(), start.Month(), monday+(int(weekday)+6)%7))
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+		return days
+	case freqMonthly:
+		first := date(start.Year(), start.Month()+time.Month(period*rc.interval), 1)
+		daysInMonth := first.AddDate(0, 1, -1).Day()
+		monthDays := rc.byMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{start.Day()}
+		}
+		days := make([]time.Time, 0, len(monthDays))
+		for _, monthDay := range monthDays {
+			if monthDay < 0 {
+				monthDay = daysInMonth + monthDay + 1
+			}
+			if monthDay < 1 || monthDay > daysInMonth {
+				continue
+			}
+			days = append(days, date(first.Year(), first.Month(), monthDay))
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+		return days
+	case freqYearly:
+		day := date(start.Year()+period*rc.interval, start.Month(), start.Day())
+		if day.Day() != start.Day() {
+			// skip years without this day, such as february 29th
+			return nil
+		}
+		return []time.Time{day}
+	default:
+		return nil
+	}
+}
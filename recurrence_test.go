@@ -0,0 +1,109 @@
+package roost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	require := require.New(t)
+	// a wednesday
+	start := time.Date(2023, time.January, 4, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule     string
+		expected []time.Time
+	}{
+		{"FREQ=DAILY", []time.Time{
+			time.Date(2023, time.January, 5, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 6, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=DAILY;INTERVAL=3", []time.Time{
+			time.Date(2023, time.January, 7, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 10, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", []time.Time{
+			time.Date(2023, time.January, 5, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 6, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 9, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=WEEKLY", []time.Time{
+			time.Date(2023, time.January, 11, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO", []time.Time{
+			time.Date(2023, time.January, 5, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 16, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 19, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.January, 30, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=MONTHLY", []time.Time{
+			time.Date(2023, time.February, 4, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.March, 4, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1", []time.Time{
+			time.Date(2023, time.January, 31, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.February, 1, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.February, 28, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=MONTHLY;BYMONTHDAY=30", []time.Time{
+			time.Date(2023, time.January, 30, 9, 30, 0, 0, time.UTC),
+			time.Date(2023, time.March, 30, 9, 30, 0, 0, time.UTC),
+		}},
+		{"FREQ=YEARLY;INTERVAL=2", []time.Time{
+			time.Date(2025, time.January, 4, 9, 30, 0, 0, time.UTC),
+		}},
+		{"RRULE:FREQ=DAILY;UNTIL=20230105T120000Z", []time.Time{
+			time.Date(2023, time.January, 5, 9, 30, 0, 0, time.UTC),
+		}},
+	}
+
+	for _, test := range tests {
+		rc, err := parseRecurrence(test.rule)
+		require.Nil(err, test.rule)
+		after := start
+		for _, expected := range test.expected {
+			next, ok := rc.next(after)
+			require.True(ok, test.rule)
+			require.Equal(expected, next, test.rule)
+			after = next
+		}
+	}
+}
+
+func TestRecurrenceUntil(t *testing.T) {
+	require := require.New(t)
+	rc, err := parseRecurrence("FREQ=DAILY;UNTIL=20230105T120000Z")
+	require.Nil(err)
+	_, ok := rc.next(time.Date(2023, time.January, 5, 9, 30, 0, 0, time.UTC))
+	require.False(ok)
+}
+
+func TestRecurrenceLeapDay(t *testing.T) {
+	require := require.New(t)
+	rc, err := parseRecurrence("FREQ=YEARLY")
+	require.Nil(err)
+	next, ok := rc.next(time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC))
+	require.True(ok)
+	require.Equal(time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC), next)
+}
+
+func TestRecurrenceInvalid(t *testing.T) {
+	require := require.New(t)
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=3",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		_, err := parseRecurrence(rule)
+		require.NotNil(err, rule)
+	}
+}
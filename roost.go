@@ -2,13 +2,22 @@ package roost
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand"
 	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
-	"strconv"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -18,9 +27,11 @@ import (
 	"github.com/meow-io/go-slick/ids"
 	"github.com/meow-io/go-slick/messaging"
 	"github.com/meow-io/go-slick/migration"
+	sqlite3 "github.com/meow-io/go-sqlcipher"
 	"github.com/rivo/uniseg"
 	"go.uber.org/zap"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -37,8 +48,42 @@ const (
 	UpdateMessagesFetched
 	UpdateUnknown
 	UpdateFinished
+	UpdateReminder
+	UpdateResyncRequired
 
 	MessagesPageSize = 20
+
+	// The number of updates a subscription can fall behind by before entity updates are dropped.
+	maxQueuedUpdates = 100
+	// The number of updates a subscription can hold before all further updates are dropped. This is only reached by
+	// a subscription which is never read.
+	queuedUpdatesLimit = 1000
+
+	departureTimeout = 10 * time.Second
+
+	databaseFilename = "data"
+	rekeySuffix      = ".rekey"
+	saltFilename     = "salt"
+)
+
+// Orderings for search results.
+const (
+	SearchOrderRelevance = iota
+	SearchOrderRecency
+)
+
+// Kinds of change to an entity. Deleting an entity includes marking it as deleted, or marking a reaction inactive.
+const (
+	EntityInserted = iota
+	EntityUpdated
+	EntityDeleted
+)
+
+// Filters on the completion state of todos in search results.
+const (
+	SearchCompletionAny = iota
+	SearchCompletionIncomplete
+	SearchCompletionComplete
 )
 
 func now() float64 {
@@ -61,9 +106,21 @@ type ViewUpdate struct {
 }
 
 type EntityUpdate struct {
-	viewName string
+	ViewName string
 	GroupID  []byte
 	EntityID []byte
+	// For reactions, the id of the message or todo reacted to.
+	TargetID []byte
+	// How the entity changed, one of EntityInserted, EntityUpdated or EntityDeleted.
+	Kind int
+	// The number of columns which changed when an entity was updated.
+	ChangedColumnCount int
+	changedColumns     []string
+}
+
+// Gets the name of a column which changed, in alphabetical order.
+func (eu *EntityUpdate) ChangedColumn(i int) string {
+	return eu.changedColumns[i]
 }
 
 const PageSize = 100
@@ -76,23 +133,105 @@ type Result struct {
 	TopicID   []byte `db:"topic_id"`
 	TopicName string `db:"topic_name"`
 	Type      string `db:"type"`
+	GroupName string `db:"-"`
+}
+
+// A structured search. Filters left as their zero value are not applied.
+type SearchQuery struct {
+	// The group to search within, or nil to search across all groups.
+	GroupID []byte
+	// Text entered by the user. Words must all match, "quoted phrases" must match exactly and -excluded words must
+	// not match. If empty, all entries matching the other filters are returned.
+	Term string
+	// One of "todo", "message" or "topic".
+	Type    string
+	TopicID []byte
+	// The identity tag of the author.
+	AuthorID []byte
+	// Only include entries created within this range, in seconds since the Unix epoch.
+	Start float64
+	End   float64
+	// One of the SearchCompletion constants. Filtering by completion only includes todos.
+	Completion int
+	// One of the SearchOrder constants. Searches without a term, or with terms too short to use a full-text index,
+	// are always ordered by recency.
+	Order          int
+	HighlightStart string
+	HighlightEnd   string
+	// The cursor from previous results to continue from, or empty to start from the first page.
+	Cursor string
+
+	search *userSearch
 }
 
+// A page of search results.
 type SearchResults struct {
 	GroupID        []byte
 	Term           string
 	HighlightStart string
 	HighlightEnd   string
-	Offset         int
 	Total          int
 	Count          int
-	results        []*Result
+	// Whether this is the last page of results.
+	AtEnd bool
+	// Pass this as the cursor of a query to fetch the next page of results.
+	Cursor  string
+	results []*Result
+	query   *SearchQuery
 }
 
 func (sr *SearchResults) Result(i int) *Result {
 	return sr.results[i]
 }
 
+// The position within search results, limited to entries indexed when the search started.
+type searchCursor struct {
+	MaxRowID int64   `json:"m"`
+	RowID    int64   `json:"r"`
+	EntityID []byte  `json:"e"`
+	Rank     float64 `json:"k"`
+}
+
+func parseSearchCursor(cursor string) (*searchCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search cursor: %w", err)
+	}
+	sc := &searchCursor{}
+	if err := json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("invalid search cursor: %w", err)
+	}
+	return sc, nil
+}
+
+func (sc *searchCursor) encode() (string, error) {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// A comparison of the search index with the todos, messages and topics it is built from.
+type SearchIndexReport struct {
+	// Entries which should be searchable but aren't indexed.
+	Missing int `db:"missing"`
+	// Indexed entries for data which has been deleted or no longer exists.
+	Stale int `db:"stale"`
+	// Indexed entries whose text, topic or type differs from the data.
+	Mismatched int `db:"mismatched"`
+	// Whether the full-text indexes agree with the indexed entries.
+	IndexesConsistent bool `db:"-"`
+}
+
+// Returns true if the search index has no drift.
+func (sir *SearchIndexReport) OK() bool {
+	return sir.Missing == 0 && sir.Stale == 0 && sir.Mismatched == 0 && sir.IndexesConsistent
+}
+
 // Topic is a organizational structure within a group.
 type Topic struct {
 	ID                  []byte  `db:"id"`
@@ -111,6 +250,8 @@ type Topic struct {
 	Pinned              bool    `db:"pinned"`
 	Position            float64 `db:"position"`
 	PinPosition         float64 `db:"pin_position"`
+	Archived            bool    `db:"archived"`
+	Deleted             bool    `db:"deleted"`
 }
 
 // Message is a chat message sent within the context of a topic.
@@ -124,6 +265,8 @@ type Message struct {
 	MembershipID []byte  `db:"_membership_tag"`
 	TopicID      []byte  `db:"topic_id"`
 	Body         string  `db:"body"`
+	Deleted      bool    `db:"deleted"`
+	ReplyToID    []byte  `db:"reply_to"`
 }
 
 // Reaction is a "rune" that refers to another entity (such as a message or todo item)
@@ -140,8 +283,34 @@ type Reaction struct {
 	EntityID     []byte  `db:"entity_id"`
 }
 
+// Profile is the name and avatar an identity shares with a group.
+type Profile struct {
+	ID           []byte  `db:"id"`
+	GroupID      []byte  `db:"group_id"`
+	CtimeSec     float64 `db:"_ctime"`
+	MtimeSec     float64 `db:"_mtime"`
+	WtimeSec     float64 `db:"_wtime"`
+	IdentityID   []byte  `db:"_identity_tag"`
+	MembershipID []byte  `db:"_membership_tag"`
+	Name         string  `db:"name"`
+	Avatar       []byte  `db:"avatar"`
+}
+
 type Device struct {
-	device *slick.Device
+	device  *slick.Device
+	current bool
+}
+
+type deviceRemoval struct {
+	ID                  []byte  `db:"id"`
+	GroupID             []byte  `db:"group_id"`
+	CtimeSec            float64 `db:"_ctime"`
+	MtimeSec            float64 `db:"_mtime"`
+	WtimeSec            float64 `db:"_wtime"`
+	IdentityID          []byte  `db:"_identity_tag"`
+	MembershipID        []byte  `db:"_membership_tag"`
+	DeviceIdentityTag   []byte  `db:"device_identity_tag"`
+	DeviceMembershipTag []byte  `db:"device_membership_tag"`
 }
 
 func (d *Device) Name() string {
@@ -152,12 +321,25 @@ func (d *Device) Type() string {
 	return d.device.Type
 }
 
+// The id of this device within the device group. This is used when removing a device.
+func (d *Device) ID() []byte {
+	return d.device.ID
+}
+
+// Returns true if this is the device Roost is currently running on.
+func (d *Device) IsCurrent() bool {
+	return d.current
+}
+
 // A container for paged messages which indicates if there are further messages and provides
 // a cursor for continued paging.
 type PagedMessages struct {
 	AtEnd  bool
 	Cursor string
 	Count  int
+	// Whether there are no messages newer than this page, and the cursor for fetching them with MessagesAfter.
+	AtNewest    bool
+	NewerCursor string
 
 	values []*Message
 }
@@ -166,22 +348,62 @@ func (pm *PagedMessages) Message(i int) *Message {
 	return pm.values[i]
 }
 
+// Sets the count and cursors for a page of messages ordered newest first.
+func (pm *PagedMessages) setCursors() {
+	pm.Count = len(pm.values)
+	if len(pm.values) != 0 {
+		pm.Cursor = messageCursor(pm.values[len(pm.values)-1].ID)
+		pm.NewerCursor = messageCursor(pm.values[0].ID)
+	}
+}
+
+// Message cursors hold the id of the message to page from. Messages are ordered by creation time and then id, and
+// as the creation time is part of the id, the id alone is enough to find the messages either side of it.
+func messageCursor(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func parseMessageCursor(cursor string) ([]byte, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message cursor: %w", err)
+	}
+	if len(id) != 16 {
+		return nil, fmt.Errorf("invalid message cursor: expected 16 bytes, got %d", len(id))
+	}
+	return id, nil
+}
+
+const (
+	olderThanCursor = "(_ctime < eav_ctime(?) OR (_ctime = eav_ctime(?) AND id < ?))"
+	newerThanCursor = "(_ctime > eav_ctime(?) OR (_ctime = eav_ctime(?) AND id > ?))"
+)
+
 // Todo item within a topic.
 type Todo struct {
-	ID                []byte  `db:"id"`
-	GroupID           []byte  `db:"group_id"`
-	CtimeSec          float64 `db:"_ctime"`
-	MtimeSec          float64 `db:"_mtime"`
-	WtimeSec          float64 `db:"_wtime"`
-	IdentityID        []byte  `db:"_identity_tag"`
-	MembershipID      []byte  `db:"_membership_tag"`
-	TopicID           []byte  `db:"topic_id"`
-	Body              string  `db:"body"`
-	CompletedAt       float64 `db:"completed_at"`
-	CompletedPosition float64 `db:"completed_position"`
-	Deleted           bool    `db:"deleted"`
-	Read              bool    `db:"read"`
-	Position          float64 `db:"position"`
+	ID                    []byte  `db:"id"`
+	GroupID               []byte  `db:"group_id"`
+	CtimeSec              float64 `db:"_ctime"`
+	MtimeSec              float64 `db:"_mtime"`
+	WtimeSec              float64 `db:"_wtime"`
+	IdentityID            []byte  `db:"_identity_tag"`
+	MembershipID          []byte  `db:"_membership_tag"`
+	TopicID               []byte  `db:"topic_id"`
+	Body                  string  `db:"body"`
+	CompletedAt           float64 `db:"completed_at"`
+	CompletedPosition     float64 `db:"completed_position"`
+	Deleted               bool    `db:"deleted"`
+	Read                  bool    `db:"read"`
+	Position              float64 `db:"position"`
+	DueAt                 float64 `db:"due_at"`
+	RemindAt              float64 `db:"remind_at"`
+	AssigneeID            []byte  `db:"assignee"`
+	Recurrence            string  `db:"recurrence"`
+	RecurrenceOf          []byte  `db:"recurrence_of"`
+	Sequence              int     `db:"sequence"`
+	ParentID              []byte  `db:"parent_id"`
+	SubtodoCount          int     `db:"subtodo_count"`
+	CompletedSubtodoCount int     `db:"completed_subtodo_count"`
 }
 
 func (t *Todo) Complete() bool {
@@ -191,11 +413,21 @@ func (t *Todo) Complete() bool {
 type Devices struct {
 	Count int
 
-	devices []*slick.Device
+	devices []*Device
 }
 
 func (d *Devices) Device(i int) *Device {
-	return &Device{d.devices[i]}
+	return d.devices[i]
+}
+
+// A list of todos, such as those due within a period of time.
+type TodoList struct {
+	Count int
+	todos []*Todo
+}
+
+func (t *TodoList) Todo(i int) *Todo {
+	return t.todos[i]
 }
 
 type Groups struct {
@@ -216,6 +448,79 @@ func (r *Reactions) Reaction(i int) *Reaction {
 	return r.reactions[i]
 }
 
+// The active reactions to an entity using the same rune.
+type RuneReaction struct {
+	Rune string
+	// The number of identities which reacted with this rune.
+	Count int
+	// Whether I reacted with this rune.
+	Mine        bool
+	identityIDs [][]byte
+}
+
+// Gets the identity tag of someone who reacted with this rune, in the order they reacted.
+func (rr *RuneReaction) IdentityID(i int) []byte {
+	return rr.identityIDs[i]
+}
+
+// The active reactions to an entity grouped by rune, in the order each rune was first used.
+type ReactionSummary struct {
+	EntityID []byte
+	Count    int
+	runes    []*RuneReaction
+}
+
+func (rs *ReactionSummary) RuneReaction(i int) *RuneReaction {
+	return rs.runes[i]
+}
+
+type ReactionSummaries struct {
+	Count     int
+	summaries []*ReactionSummary
+}
+
+func (rs *ReactionSummaries) Summary(i int) *ReactionSummary {
+	return rs.summaries[i]
+}
+
+// A member of a group. Members who haven't shared a profile have an empty name and no avatar.
+type Member struct {
+	// The identity tag of the member, matching the IdentityID of the things they write.
+	IdentityID []byte
+	Name       string
+	Avatar     []byte
+	// Whether this member is me.
+	Me bool
+}
+
+type Members struct {
+	Count   int
+	members []*Member
+}
+
+func (m *Members) Member(i int) *Member {
+	return m.members[i]
+}
+
+// A list of ids, used to pass several ids at once.
+type IDList struct {
+	Count int
+	ids   [][]byte
+}
+
+func NewIDList() *IDList {
+	return &IDList{}
+}
+
+func (l *IDList) Add(id []byte) {
+	l.ids = append(l.ids, id)
+	l.Count = len(l.ids)
+}
+
+func (l *IDList) ID(i int) []byte {
+	return l.ids[i]
+}
+
 type AppState struct {
 	State int
 }
@@ -243,6 +548,16 @@ type IntroUpdate struct {
 	Type      int
 }
 
+// An update emitted when the reminder for a todo comes due.
+type ReminderUpdate struct {
+	GroupID  []byte
+	TodoID   []byte
+	TopicID  []byte
+	Body     string
+	DueAt    float64
+	RemindAt float64
+}
+
 type TransportStateUpdate struct {
 	URL   string
 	State string
@@ -281,21 +596,158 @@ func (t *TransportStates) State(i int) string {
 //	  *EntityUpdate: an update about a specific view row within roost, for instance `todos`, `topics` or `messages`.
 //	  *IntroUpdate: an update about a specific table within roost, for instance `todos`, `topics` or `messages`.
 //	  *StateUpdate: an update about a specific table within roost, for instance `todos`, `topics` or `messages`.
+//	  *ReminderUpdate: a reminder for a todo has come due.
+//	  *ResyncRequired: entity updates were dropped as the subscription fell behind.
 type Updates struct {
-	updates chan interface{}
-	item    interface{}
+	item      interface{}
+	filter    *UpdateFilter
+	lock      sync.Mutex
+	queue     []interface{}
+	resyncing bool
+	ready     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	roost     *Roost
 }
 
+// Sent in place of entity updates once a subscription falls behind; views should be reloaded.
+type ResyncRequired struct{}
+
+// Selects the updates delivered to a subscription. Empty fields match every update.
+type UpdateFilter struct {
+	GroupID  []byte
+	ViewName string
+	types    []int
+}
+
+// Also deliver updates of the given type, one of the Update constants.
+func (uf *UpdateFilter) AddType(updateType int) {
+	uf.types = append(uf.types, updateType)
+}
+
+func (uf *UpdateFilter) matches(item interface{}) bool {
+	if uf == nil {
+		return true
+	}
+	if len(uf.types) != 0 && !slices.Contains(uf.types, updateType(item)) {
+		return false
+	}
+	if len(uf.GroupID) != 0 && !bytes.Equal(uf.GroupID, updateGroupID(item)) {
+		return false
+	}
+	if uf.ViewName != "" && uf.ViewName != updateViewName(item) {
+		return false
+	}
+	return true
+}
+
+// Waits for the next update. Once the subscription is closed, the type of the update is UpdateFinished.
 func (u *Updates) Next() {
-	u.item = <-u.updates
+	for {
+		select {
+		case <-u.done:
+			u.item = nil
+			return
+		default:
+		}
+
+		u.lock.Lock()
+		if len(u.queue) != 0 {
+			u.item = u.queue[0]
+			u.queue[0] = nil
+			u.queue = u.queue[1:]
+			if _, ok := u.item.(*ResyncRequired); ok {
+				u.resyncing = false
+			}
+			u.lock.Unlock()
+			return
+		}
+		u.lock.Unlock()
+
+		select {
+		case <-u.ready:
+		case <-u.done:
+		}
+	}
+}
+
+// Stops delivering updates to this subscription.
+func (u *Updates) Close() {
+	u.closeOnce.Do(func() {
+		close(u.done)
+		u.roost.unsubscribe(u)
+	})
+}
+
+// Queues an update for this subscription without blocking, coalescing it with updates already waiting.
+func (u *Updates) enqueue(item interface{}) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	switch update := item.(type) {
+	case *ViewUpdate:
+		for _, queued := range u.queue {
+			if vu, ok := queued.(*ViewUpdate); ok && vu.viewName == update.viewName {
+				return
+			}
+		}
+	case *slick.GroupUpdate:
+		// changes of state, such as an intro succeeding, are kept so they aren't missed
+		for i, queued := range u.queue {
+			if gu, ok := queued.(*slick.GroupUpdate); ok && gu.ID == update.ID && gu.GroupState == update.GroupState {
+				u.queue[i] = update
+				return
+			}
+		}
+	case *slick.TransportStateUpdate:
+		for i, queued := range u.queue {
+			if tsu, ok := queued.(*slick.TransportStateUpdate); ok && tsu.URL == update.URL {
+				u.queue[i] = update
+				return
+			}
+		}
+	case *EntityUpdate:
+		if u.resyncing {
+			return
+		}
+	}
+	if len(u.queue) >= maxQueuedUpdates && !u.resyncing {
+		queue := make([]interface{}, 0, len(u.queue)+1)
+		for _, queued := range u.queue {
+			if _, ok := queued.(*EntityUpdate); !ok {
+				queue = append(queue, queued)
+			}
+		}
+		u.queue = append(queue, &ResyncRequired{})
+		u.resyncing = true
+		if _, ok := item.(*EntityUpdate); ok {
+			return
+		}
+	}
+	if len(u.queue) >= queuedUpdatesLimit {
+		u.roost.log.Debugf("update dropped from full subscription %#v", item)
+		return
+	}
+	u.queue = append(u.queue, item)
+	select {
+	case u.ready <- struct{}{}:
+	default:
+	}
 }
 
 func (u *Updates) Type() int {
-	if u.item == nil {
+	t := updateType(u.item)
+	if t == UpdateUnknown {
+		u.roost.log.Warnf("unknown update type %T", u.item)
+	}
+	return t
+}
+
+func updateType(item interface{}) int {
+	if item == nil {
 		return UpdateFinished
 	}
 
-	switch u.item.(type) {
+	switch item.(type) {
 	case *slick.AppState:
 		return UpdateAppState
 	case *slick.GroupUpdate:
@@ -310,12 +762,43 @@ func (u *Updates) Type() int {
 		return UpdateTransportStateUpdate
 	case *slick.MessagesFetchedUpdate:
 		return UpdateMessagesFetched
+	case *ReminderUpdate:
+		return UpdateReminder
+	case *ResyncRequired:
+		return UpdateResyncRequired
 	default:
-		fmt.Printf("unknown event type is %T\n", u.item)
 		return UpdateUnknown
 	}
 }
 
+// Gets the id of the group an update is about, or nil if it isn't about a group.
+func updateGroupID(item interface{}) []byte {
+	switch u := item.(type) {
+	case *slick.GroupUpdate:
+		return u.ID[:]
+	case *EntityUpdate:
+		return u.GroupID
+	case *slick.IntroUpdate:
+		return u.GroupID[:]
+	case *ReminderUpdate:
+		return u.GroupID
+	default:
+		return nil
+	}
+}
+
+// Gets the name of the view an update is about, or "" if it isn't about a view.
+func updateViewName(item interface{}) string {
+	switch u := item.(type) {
+	case *ViewUpdate:
+		return u.viewName
+	case *EntityUpdate:
+		return u.ViewName
+	default:
+		return ""
+	}
+}
+
 func (u *Updates) AppState() *AppState {
 	return &AppState{u.item.(*slick.AppState).State}
 }
@@ -349,6 +832,10 @@ func (u *Updates) ViewEntityUpdate() *EntityUpdate {
 	return u.item.(*EntityUpdate)
 }
 
+func (u *Updates) ReminderUpdate() *ReminderUpdate {
+	return u.item.(*ReminderUpdate)
+}
+
 func (u *Updates) IntroUpdate() *IntroUpdate {
 	tu := u.item.(*slick.IntroUpdate)
 	return &IntroUpdate{
@@ -387,7 +874,7 @@ func (tu *TodoUpdater) MarkRead(id []byte, read bool) {
 	tu.read[ids.IDFromBytes(id)] = read
 }
 
-// also give them new positions when you complete them
+// also give them new positions when you complete them. Completing a recurring todo creates its next occurrence.
 func (tu *TodoUpdater) Commit() error {
 	nowTs := now()
 	writer := tu.rg.roost.slick.EAVWriter(tu.rg.group)
@@ -395,6 +882,9 @@ func (tu *TodoUpdater) Commit() error {
 	for k, v := range tu.completed {
 		k := k
 		if v {
+			if err := tu.rg.writeNextOccurrence(writer, k[:], nowTs); err != nil {
+				return err
+			}
 			writer.Update("todos", k[:], map[string]interface{}{
 				"completed_at":       nowTs,
 				"completed_position": -nowTs,
@@ -431,25 +921,70 @@ func (t *Topics) Topic(i int) *Topic {
 	if i < len(t.pinnedTopics) {
 		return t.pinnedTopics[i]
 	}
-	return t.unpinnedTopics[i+len(t.pinnedTopics)]
+	return t.unpinnedTopics[i-len(t.pinnedTopics)]
 }
 
 type Roost struct {
 	log           *zap.SugaredLogger
 	slick         *slick.Slick
+	root          string
 	State         int
 	keyMaker      keyMaker
 	heyaAuthToken string
-	updates       chan interface{}
+	destroyLock   sync.Mutex
+	keyDigest     [32]byte
+	remindersLock sync.Mutex
+	reminders     *reminderScheduler
+	reminderWake  chan struct{}
+	profilesLock  sync.Mutex
+	profileShared map[ids.ID]bool
+
+	subscriptionsLock sync.Mutex
+	subscriptions     []*Updates
+	subscribed        bool
+	heldUpdates       []interface{}
+
+	// changes and updates recorded within the current transaction, guarded by the database lock
+	entityChanges map[string]*entityChange
+	stagedUpdates []interface{}
 }
 
 // Makes a Roost instance with a given key maker. Not typically used outside of tests.
 func MakeRoostWithKeyMaker(root, heyaAuthToken string, keyMaker keyMaker) (*Roost, error) {
-	c := config.NewConfig(config.WithLoggingPrefix(root), config.WithRootDir(root))
-	log := c.Logger("roost")
+	log := newConfig(root).Logger("roost")
+
+	// a leftover re-encrypted database means a password change was interrupted before completing
+	if err := os.RemoveAll(filepath.Join(root, databaseFilename+rekeySuffix)); err != nil {
+		return nil, err
+	}
+
+	r := &Roost{
+		log:           log,
+		root:          root,
+		State:         StateNew,
+		keyMaker:      keyMaker,
+		heyaAuthToken: heyaAuthToken,
+		reminderWake:  make(chan struct{}, 1),
+		profileShared: make(map[ids.ID]bool),
+	}
+	s, err := r.makeSlick()
+	if err != nil {
+		return nil, err
+	}
+	r.slick = s
+	if s.Initialized() {
+		r.State = StateLocked
+	}
+
+	return r, nil
+}
 
-	updates := make(chan interface{}, 100)
-	s, err := slick.NewSlick(c, func(s *slick.Slick) error {
+func newConfig(root string) *config.Config {
+	return config.NewConfig(config.WithLoggingPrefix(root), config.WithRootDir(root))
+}
+
+func (r *Roost) makeSlick() (*slick.Slick, error) {
+	s, err := slick.NewSlick(newConfig(r.root), func(s *slick.Slick) error {
 		err := s.DB.Migrate("roost", []*migration.Migration{
 			{
 				Name: "Create initial tables",
@@ -596,15 +1131,7 @@ func MakeRoostWithKeyMaker(root, heyaAuthToken string, keyMaker keyMaker) (*Roos
 						return err
 					}
 
-					statementTmpl, err := template.New("index_statement").
-						Funcs(template.FuncMap{
-							"index_where": func(viewName, prefix string) (string, error) {
-								return s.EAVIndexWhere(viewName, prefix)
-							},
-							"selectors": func(viewName, prefix string, colName ...string) (string, error) {
-								return s.EAVSelectors(viewName, prefix, colName...)
-							},
-						}).Parse(`
+					return execTemplate(s, tx, `
 					CREATE TABLE fs_contents(
 					id INTEGER PRIMARY KEY,
 					group_id BINARY NOT NULL,
@@ -674,255 +1201,1735 @@ func MakeRoostWithKeyMaker(root, heyaAuthToken string, keyMaker keyMaker) (*Roos
 						group_id = {{ selectors "messages" "new." "group_id"}} and entity_id = {{ selectors "messages" "new." "id"}};
 					END;
 					`)
-					if err != nil {
-						return err
-					}
-					var t bytes.Buffer
-					if err := statementTmpl.Execute(&t, nil); err != nil {
-						return err
-					}
-					sql := t.String()
-					if _, err := tx.Exec(sql); err != nil {
-						return err
-					}
-					return nil
 				},
 			},
-		})
-		if err != nil {
-			return err
-		}
-		s.EAVSubscribeAfterEntity(func(viewName string, groupID, id ids.ID) {
-			updates <- &EntityUpdate{viewName, groupID[:], id[:]}
-		}, false, "todos", "messages", "topics")
-
-		s.EAVSubscribeAfterView(func(viewName string) {
-			updates <- &ViewUpdate{viewName}
-		}, false, "todos", "messages", "topics")
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	u := s.Updates()
-	go func() {
-		for i := range u {
-			updates <- i
-		}
-	}()
-
-	state := StateNew
-	if s.Initialized() {
-		state = StateLocked
-	}
-
-	return &Roost{log, s, state, keyMaker, heyaAuthToken, updates}, nil
-}
-
-// Makes a Roost instance for a given root directory.
-func MakeRoost(root, heyaAuthToken string) (*Roost, error) {
-	return MakeRoostWithKeyMaker(root, heyaAuthToken, func(r *Roost, p string) ([]byte, error) {
-		return r.slick.NewKey(p)
-	})
-}
-
-// Makes a Roost instance for a given root directory.
-func MakeRoostWithStrongKey(root, heyaAuthToken string) (*Roost, error) {
-	return MakeRoostWithKeyMaker(root, heyaAuthToken, func(r *Roost, p string) ([]byte, error) {
-		return []byte(p), nil
-	})
-}
-
-// Get current transport states
-func (r *Roost) TransportStates() *TransportStates {
-	return makeTransportStates(r.slick.TransportStates())
-}
-
-// Generates a random 6-digit pin
-func (r *Roost) NewPin() (string, error) {
-	return slick.NewPin()
-}
-
-// Get the underlying Slick instance
-func (r *Roost) Slick() *slick.Slick {
-	return r.slick
-}
-
-// Gets a device link which can be used to link a device to the current device group.
-func (r *Roost) GetDeviceLink() (string, error) {
-	link, err := r.slick.DeviceGroup.GetDeviceLink()
-	if err != nil {
-		return "", err
+			{
+				Name: "Create device removals",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"device_removals": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"device_identity_tag": {
+									SourceName: "device_removal_identity_tag",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"device_membership_tag": {
+									SourceName: "device_removal_membership_tag",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+							},
+							Indexes: [][]string{{"group_id"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add deleted and archived topics",
+				Func: func(tx *sql.Tx) error {
+					if err := s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"topics": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"label": {
+									SourceName: "topic_label",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"message_last_read": {
+									SourceName:   "_self_topic_message_last_read",
+									ColumnType:   eav.Real,
+									DefaultValue: val(float64(0)),
+									Required:     false,
+									Nullable:     false,
+								},
+								"show_completed": {
+									SourceName:   "_self_topic_show_completed",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"position": {
+									SourceName:   "_self_topic_position",
+									ColumnType:   eav.Real,
+									Nullable:     false,
+									DefaultValue: val(0),
+								},
+								"pin_position": {
+									SourceName:   "_self_topic_pin_position",
+									ColumnType:   eav.Real,
+									Nullable:     false,
+									DefaultValue: val(0),
+								},
+								"pinned": {
+									SourceName:   "_self_topic_pinned",
+									ColumnType:   eav.Int,
+									Nullable:     false,
+									DefaultValue: val(0),
+								},
+								"archived": {
+									SourceName:   "topic_archived",
+									ColumnType:   eav.Int,
+									Nullable:     false,
+									DefaultValue: val(0),
+								},
+								"deleted": {
+									SourceName:   "topic_deleted",
+									ColumnType:   eav.Int,
+									Nullable:     false,
+									DefaultValue: val(0),
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id"}},
+						},
+					}); err != nil {
+						return err
+					}
+					return execTemplate(s, tx, `
+					DELETE FROM fs_contents WHERE type = 'todo' AND entity_id IN (SELECT id FROM todos WHERE todos.group_id = fs_contents.group_id AND deleted != 0);
+
+					DROP TRIGGER todos_insert_contents;
+					CREATE TRIGGER todos_insert_contents AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "todos"  "new." }}) AND COALESCE(CAST({{ selectors "todos" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents
+						(group_id, topic_id, entity_id, text, type) VALUES
+						({{ selectors "todos" "new." "group_id" "topic_id" "id" "body" }}, 'todo');
+					END;
+
+					CREATE TRIGGER todos_delete_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "todos"  "new." }}) AND COALESCE(CAST({{ selectors "todos" "new." "deleted" }} AS INTEGER), 0) != 0
+					BEGIN
+					DELETE FROM fs_contents WHERE group_id = new.group_id AND entity_id = new.id;
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add deleted messages",
+				Func: func(tx *sql.Tx) error {
+					if err := s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"messages": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "message_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "message_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"deleted": {
+									SourceName:   "message_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id"}},
+						},
+					}); err != nil {
+						return err
+					}
+					return execTemplate(s, tx, `
+					DROP TRIGGER messages_insert_contents;
+					CREATE TRIGGER messages_insert_contents AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "messages" "new." }}) AND COALESCE(CAST({{ selectors "messages" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents
+						(group_id, topic_id, entity_id, text, type) VALUES
+						({{ selectors "messages" "new." "group_id" "topic_id" "id" "body" }}, 'message');
+					END;
+
+					CREATE TRIGGER messages_delete_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "messages"  "new." }}) AND COALESCE(CAST({{ selectors "messages" "new." "deleted" }} AS INTEGER), 0) != 0
+					BEGIN
+					DELETE FROM fs_contents WHERE group_id = new.group_id AND entity_id = new.id;
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add todo due dates and reminders",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"todos": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "todo_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "todo_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"read": {
+									SourceName:   "_self_todo_read",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_at": {
+									SourceName:   "todo_completed_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"deleted": {
+									SourceName:   "todo_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"position": {
+									SourceName:   "todo_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_position": {
+									SourceName:   "todo_completed_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"due_at": {
+									SourceName:   "todo_due_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"remind_at": {
+									SourceName:   "_self_todo_remind_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id", "read"}, {"due_at"}, {"remind_at"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add todo assignees",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"todos": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "todo_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "todo_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"read": {
+									SourceName:   "_self_todo_read",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_at": {
+									SourceName:   "todo_completed_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"deleted": {
+									SourceName:   "todo_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"position": {
+									SourceName:   "todo_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_position": {
+									SourceName:   "todo_completed_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"due_at": {
+									SourceName:   "todo_due_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"remind_at": {
+									SourceName:   "_self_todo_remind_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"assignee": {
+									SourceName: "todo_assignee",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id", "read"}, {"due_at"}, {"remind_at"}, {"group_id", "assignee"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add recurring todos",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"todos": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "todo_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "todo_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"read": {
+									SourceName:   "_self_todo_read",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_at": {
+									SourceName:   "todo_completed_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"deleted": {
+									SourceName:   "todo_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"position": {
+									SourceName:   "todo_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_position": {
+									SourceName:   "todo_completed_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"due_at": {
+									SourceName:   "todo_due_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"remind_at": {
+									SourceName:   "_self_todo_remind_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"assignee": {
+									SourceName: "todo_assignee",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+								"recurrence": {
+									SourceName:   "todo_recurrence",
+									ColumnType:   eav.Text,
+									DefaultValue: val(""),
+									Required:     false,
+									Nullable:     false,
+								},
+								"recurrence_of": {
+									SourceName: "todo_recurrence_of",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+								"sequence": {
+									SourceName:   "todo_sequence",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id", "read"}, {"due_at"}, {"remind_at"}, {"group_id", "assignee"}, {"group_id", "recurrence_of", "sequence"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add subtodos",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"todos": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "todo_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "todo_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"read": {
+									SourceName:   "_self_todo_read",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_at": {
+									SourceName:   "todo_completed_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"deleted": {
+									SourceName:   "todo_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"position": {
+									SourceName:   "todo_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"completed_position": {
+									SourceName:   "todo_completed_position",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"due_at": {
+									SourceName:   "todo_due_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"remind_at": {
+									SourceName:   "_self_todo_remind_at",
+									ColumnType:   eav.Real,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"assignee": {
+									SourceName: "todo_assignee",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+								"recurrence": {
+									SourceName:   "todo_recurrence",
+									ColumnType:   eav.Text,
+									DefaultValue: val(""),
+									Required:     false,
+									Nullable:     false,
+								},
+								"recurrence_of": {
+									SourceName: "todo_recurrence_of",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+								"sequence": {
+									SourceName:   "todo_sequence",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"parent_id": {
+									SourceName: "todo_parent_id",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id", "read"}, {"due_at"}, {"remind_at"}, {"group_id", "assignee"}, {"group_id", "recurrence_of", "sequence"}, {"group_id", "parent_id"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add message replies",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"messages": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"body": {
+									SourceName: "message_body",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"topic_id": {
+									SourceName: "message_topic_id",
+									ColumnType: eav.Blob,
+									Required:   true,
+									Nullable:   false,
+								},
+								"deleted": {
+									SourceName:   "message_deleted",
+									ColumnType:   eav.Int,
+									DefaultValue: val(0),
+									Required:     false,
+									Nullable:     false,
+								},
+								"reply_to": {
+									SourceName: "message_reply_to",
+									ColumnType: eav.Blob,
+									Required:   false,
+									Nullable:   true,
+								},
+							},
+							Indexes: [][]string{{"_ctime"}, {"group_id", "topic_id"}, {"group_id", "reply_to"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Add diacritic removal and trigram search indexes",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(`
+					DROP TRIGGER fs_content_fts_idx_ai;
+					DROP TRIGGER fs_content_fts_idx_ad;
+					DROP TRIGGER fs_content_fts_idx_au;
+					DROP TABLE fs_content_fts_idx;
+
+					CREATE VIRTUAL TABLE fs_content_fts_idx USING fts5(text, content='fs_contents', content_rowid='id', tokenize='unicode61 remove_diacritics 2');
+					CREATE VIRTUAL TABLE fs_content_trigram_idx USING fts5(text, content='fs_contents', content_rowid='id', tokenize='trigram');
+
+					CREATE TRIGGER fs_content_fts_idx_ai AFTER INSERT ON fs_contents BEGIN
+					INSERT INTO fs_content_fts_idx(rowid, text) VALUES (new.id, new.text);
+					INSERT INTO fs_content_trigram_idx(rowid, text) VALUES (new.id, new.text);
+					END;
+					CREATE TRIGGER fs_content_fts_idx_ad AFTER DELETE ON fs_contents BEGIN
+					INSERT INTO fs_content_fts_idx(fs_content_fts_idx, rowid, text) VALUES('delete', old.id, old.text);
+					INSERT INTO fs_content_trigram_idx(fs_content_trigram_idx, rowid, text) VALUES('delete', old.id, old.text);
+					END;
+					CREATE TRIGGER fs_content_fts_idx_au AFTER UPDATE ON fs_contents BEGIN
+					INSERT INTO fs_content_fts_idx(fs_content_fts_idx, rowid, text) VALUES('delete', old.id, old.text);
+					INSERT INTO fs_content_fts_idx(rowid, text) VALUES(new.id, new.text);
+					INSERT INTO fs_content_trigram_idx(fs_content_trigram_idx, rowid, text) VALUES('delete', old.id, old.text);
+					INSERT INTO fs_content_trigram_idx(rowid, text) VALUES(new.id, new.text);
+					END;
+
+					INSERT INTO fs_content_fts_idx(fs_content_fts_idx) VALUES('rebuild');
+					INSERT INTO fs_content_trigram_idx(fs_content_trigram_idx) VALUES('rebuild');
+					`)
+					return err
+				},
+			},
+			{
+				Name: "Index topic labels",
+				Func: func(tx *sql.Tx) error {
+					return execTemplate(s, tx, `
+					INSERT INTO fs_contents (group_id, topic_id, entity_id, type, text) SELECT group_id, id, id, 'topic', label FROM topics WHERE deleted = 0;
+
+					-- topics are upserted as renames update the same row and changes to columns other than the label are ignored
+					CREATE TRIGGER topics_upsert_contents AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "topics" "new." }}) AND COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents
+						(group_id, topic_id, entity_id, text, type) VALUES
+						({{ selectors "topics" "new." "group_id" "id" "id" "label" }}, 'topic')
+					ON CONFLICT(group_id, entity_id) DO UPDATE SET text = excluded.text WHERE fs_contents.text != excluded.text;
+					END;
+					CREATE TRIGGER topics_update_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "topics" "new." }}) AND COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents
+						(group_id, topic_id, entity_id, text, type) VALUES
+						({{ selectors "topics" "new." "group_id" "id" "id" "label" }}, 'topic')
+					ON CONFLICT(group_id, entity_id) DO UPDATE SET text = excluded.text WHERE fs_contents.text != excluded.text;
+					END;
+					CREATE TRIGGER topics_delete_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "topics" "new." }}) AND COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) != 0
+					BEGIN
+					DELETE FROM fs_contents WHERE group_id = new.group_id AND entity_id = new.id;
+					END;
+					CREATE TRIGGER topics_eav_data_delete_contents AFTER DELETE ON _eav_data
+					WHEN ({{ index_where "topics" "old." }})
+					BEGIN
+					DELETE FROM fs_contents WHERE group_id = old.group_id AND entity_id = old.id;
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add entity change triggers",
+				Func: func(tx *sql.Tx) error {
+					// each change is recorded with whether the entity existed and wasn't deleted before and after it,
+					// followed by the name, old value and new value of each column
+					return execTemplate(s, tx, `
+					CREATE TRIGGER todos_record_insert AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "todos" "new." }})
+					BEGIN
+					SELECT roost_entity_change('todos', new.group_id, new.id, 0, COALESCE(CAST({{ selectors "todos" "new." "deleted" }} AS INTEGER), 0) = 0);
+					END;
+					CREATE TRIGGER todos_record_update AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "todos" "new." }})
+					BEGIN
+					SELECT roost_entity_change('todos', new.group_id, new.id,
+						({{ index_where "todos" "old." }}) AND COALESCE(CAST({{ selectors "todos" "old." "deleted" }} AS INTEGER), 0) = 0,
+						COALESCE(CAST({{ selectors "todos" "new." "deleted" }} AS INTEGER), 0) = 0,
+						'body', CAST({{ selectors "todos" "old." "body" }} AS TEXT), CAST({{ selectors "todos" "new." "body" }} AS TEXT),
+						'topic_id', CAST({{ selectors "todos" "old." "topic_id" }} AS BLOB), CAST({{ selectors "todos" "new." "topic_id" }} AS BLOB),
+						'read', CAST(COALESCE({{ selectors "todos" "old." "read" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "todos" "new." "read" }}, 0) AS INTEGER),
+						'completed_at', CAST(COALESCE({{ selectors "todos" "old." "completed_at" }}, 0) AS REAL), CAST(COALESCE({{ selectors "todos" "new." "completed_at" }}, 0) AS REAL),
+						'deleted', CAST(COALESCE({{ selectors "todos" "old." "deleted" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "todos" "new." "deleted" }}, 0) AS INTEGER),
+						'position', CAST(COALESCE({{ selectors "todos" "old." "position" }}, 0) AS REAL), CAST(COALESCE({{ selectors "todos" "new." "position" }}, 0) AS REAL),
+						'completed_position', CAST(COALESCE({{ selectors "todos" "old." "completed_position" }}, 0) AS REAL), CAST(COALESCE({{ selectors "todos" "new." "completed_position" }}, 0) AS REAL),
+						'due_at', CAST(COALESCE({{ selectors "todos" "old." "due_at" }}, 0) AS REAL), CAST(COALESCE({{ selectors "todos" "new." "due_at" }}, 0) AS REAL),
+						'remind_at', CAST(COALESCE({{ selectors "todos" "old." "remind_at" }}, 0) AS REAL), CAST(COALESCE({{ selectors "todos" "new." "remind_at" }}, 0) AS REAL),
+						'assignee', CAST({{ selectors "todos" "old." "assignee" }} AS BLOB), CAST({{ selectors "todos" "new." "assignee" }} AS BLOB),
+						'recurrence', CAST(COALESCE({{ selectors "todos" "old." "recurrence" }}, '') AS TEXT), CAST(COALESCE({{ selectors "todos" "new." "recurrence" }}, '') AS TEXT),
+						'recurrence_of', CAST({{ selectors "todos" "old." "recurrence_of" }} AS BLOB), CAST({{ selectors "todos" "new." "recurrence_of" }} AS BLOB),
+						'sequence', CAST(COALESCE({{ selectors "todos" "old." "sequence" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "todos" "new." "sequence" }}, 0) AS INTEGER),
+						'parent_id', CAST({{ selectors "todos" "old." "parent_id" }} AS BLOB), CAST({{ selectors "todos" "new." "parent_id" }} AS BLOB));
+					END;
+					CREATE TRIGGER messages_record_insert AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "messages" "new." }})
+					BEGIN
+					SELECT roost_entity_change('messages', new.group_id, new.id, 0, COALESCE(CAST({{ selectors "messages" "new." "deleted" }} AS INTEGER), 0) = 0);
+					END;
+					CREATE TRIGGER messages_record_update AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "messages" "new." }})
+					BEGIN
+					SELECT roost_entity_change('messages', new.group_id, new.id,
+						({{ index_where "messages" "old." }}) AND COALESCE(CAST({{ selectors "messages" "old." "deleted" }} AS INTEGER), 0) = 0,
+						COALESCE(CAST({{ selectors "messages" "new." "deleted" }} AS INTEGER), 0) = 0,
+						'body', CAST({{ selectors "messages" "old." "body" }} AS TEXT), CAST({{ selectors "messages" "new." "body" }} AS TEXT),
+						'topic_id', CAST({{ selectors "messages" "old." "topic_id" }} AS BLOB), CAST({{ selectors "messages" "new." "topic_id" }} AS BLOB),
+						'deleted', CAST(COALESCE({{ selectors "messages" "old." "deleted" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "messages" "new." "deleted" }}, 0) AS INTEGER),
+						'reply_to', CAST({{ selectors "messages" "old." "reply_to" }} AS BLOB), CAST({{ selectors "messages" "new." "reply_to" }} AS BLOB));
+					END;
+					CREATE TRIGGER topics_record_insert AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "topics" "new." }})
+					BEGIN
+					SELECT roost_entity_change('topics', new.group_id, new.id, 0, COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) = 0);
+					END;
+					CREATE TRIGGER topics_record_update AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "topics" "new." }})
+					BEGIN
+					SELECT roost_entity_change('topics', new.group_id, new.id,
+						({{ index_where "topics" "old." }}) AND COALESCE(CAST({{ selectors "topics" "old." "deleted" }} AS INTEGER), 0) = 0,
+						COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) = 0,
+						'label', CAST({{ selectors "topics" "old." "label" }} AS TEXT), CAST({{ selectors "topics" "new." "label" }} AS TEXT),
+						'message_last_read', CAST(COALESCE({{ selectors "topics" "old." "message_last_read" }}, 0) AS REAL), CAST(COALESCE({{ selectors "topics" "new." "message_last_read" }}, 0) AS REAL),
+						'show_completed', CAST(COALESCE({{ selectors "topics" "old." "show_completed" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "topics" "new." "show_completed" }}, 0) AS INTEGER),
+						'position', CAST(COALESCE({{ selectors "topics" "old." "position" }}, 0) AS REAL), CAST(COALESCE({{ selectors "topics" "new." "position" }}, 0) AS REAL),
+						'pin_position', CAST(COALESCE({{ selectors "topics" "old." "pin_position" }}, 0) AS REAL), CAST(COALESCE({{ selectors "topics" "new." "pin_position" }}, 0) AS REAL),
+						'pinned', CAST(COALESCE({{ selectors "topics" "old." "pinned" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "topics" "new." "pinned" }}, 0) AS INTEGER),
+						'archived', CAST(COALESCE({{ selectors "topics" "old." "archived" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "topics" "new." "archived" }}, 0) AS INTEGER),
+						'deleted', CAST(COALESCE({{ selectors "topics" "old." "deleted" }}, 0) AS INTEGER), CAST(COALESCE({{ selectors "topics" "new." "deleted" }}, 0) AS INTEGER));
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add reaction updates",
+				Func: func(tx *sql.Tx) error {
+					return execTemplate(s, tx, `
+					CREATE TRIGGER reactions_record_insert AFTER INSERT ON _eav_data
+					WHEN ({{ index_where "reactions" "new." }})
+					BEGIN
+					SELECT roost_entity_change('reactions', new.group_id, new.id, 0, COALESCE(CAST({{ selectors "reactions" "new." "active" }} AS INTEGER), 1) != 0, 'entity_id', NULL, CAST({{ selectors "reactions" "new." "entity_id" }} AS BLOB));
+					END;
+					CREATE TRIGGER reactions_record_update AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "reactions" "new." }})
+					BEGIN
+					SELECT roost_entity_change('reactions', new.group_id, new.id,
+						({{ index_where "reactions" "old." }}) AND COALESCE(CAST({{ selectors "reactions" "old." "active" }} AS INTEGER), 1) != 0,
+						COALESCE(CAST({{ selectors "reactions" "new." "active" }} AS INTEGER), 1) != 0,
+						'active', CAST(COALESCE({{ selectors "reactions" "old." "active" }}, 1) AS INTEGER), CAST(COALESCE({{ selectors "reactions" "new." "active" }}, 1) AS INTEGER),
+						'entity_id', CAST({{ selectors "reactions" "old." "entity_id" }} AS BLOB), CAST({{ selectors "reactions" "new." "entity_id" }} AS BLOB),
+						'rune', CAST({{ selectors "reactions" "old." "rune" }} AS TEXT), CAST({{ selectors "reactions" "new." "rune" }} AS TEXT));
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add profiles",
+				Func: func(tx *sql.Tx) error {
+					return s.EAVCreateViews(map[string]*eav.ViewDefinition{
+						"profiles": {
+							Columns: map[string]*eav.ColumnDefinition{
+								"name": {
+									SourceName: "profile_name",
+									ColumnType: eav.Text,
+									Required:   true,
+									Nullable:   false,
+								},
+								"avatar": {
+									SourceName: "profile_avatar",
+									ColumnType: eav.Blob,
+									Nullable:   true,
+								},
+							},
+							Indexes: [][]string{{"group_id"}},
+						},
+					})
+				},
+			},
+			{
+				Name: "Re-index restored todos and topics",
+				Func: func(tx *sql.Tx) error {
+					return execTemplate(s, tx, `
+					CREATE TRIGGER todos_undelete_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "todos" "new." }}) AND COALESCE(CAST({{ selectors "todos" "old." "deleted" }} AS INTEGER), 0) != 0 AND COALESCE(CAST({{ selectors "todos" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents
+						(group_id, topic_id, entity_id, text, type) VALUES
+						({{ selectors "todos" "new." "group_id" "topic_id" "id" "body" }}, 'todo')
+					ON CONFLICT(group_id, entity_id) DO NOTHING;
+					END;
+
+					-- archiving keeps a topic searchable, so anything missing from it is restored when it's unarchived
+					CREATE TRIGGER topics_unarchive_contents AFTER UPDATE ON _eav_data
+					WHEN ({{ index_where "topics" "new." }}) AND COALESCE(CAST({{ selectors "topics" "old." "archived" }} AS INTEGER), 0) != 0 AND COALESCE(CAST({{ selectors "topics" "new." "archived" }} AS INTEGER), 0) = 0 AND COALESCE(CAST({{ selectors "topics" "new." "deleted" }} AS INTEGER), 0) = 0
+					BEGIN
+					INSERT INTO fs_contents (group_id, topic_id, entity_id, type, text)
+						SELECT group_id, topic_id, id, 'todo', body FROM todos WHERE group_id = new.group_id AND topic_id = new.id AND deleted = 0
+						UNION ALL SELECT group_id, topic_id, id, 'message', body FROM messages WHERE group_id = new.group_id AND topic_id = new.id AND deleted = 0
+					ON CONFLICT(group_id, entity_id) DO NOTHING;
+					END;
+					`)
+				},
+			},
+			{
+				Name: "Add reminder checks",
+				Func: func(tx *sql.Tx) error {
+					if _, err := tx.Exec("CREATE TABLE reminder_checks(checked_at REAL NOT NULL)"); err != nil {
+						return err
+					}
+					// reminders which came due before this was tracked aren't emitted
+					_, err := tx.Exec("INSERT INTO reminder_checks (checked_at) VALUES (?)", now())
+					return err
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if err := r.registerConnectionHooks(s); err != nil {
+			return err
+		}
+		s.EAVSubscribeBeforeEntity(func(viewName string, groupID, id ids.ID) error {
+			if update := r.entityUpdate(viewName, groupID[:], id[:]); update != nil {
+				r.stageUpdate(update)
+			}
+			return nil
+		}, false, "todos", "messages", "topics", "reactions")
+
+		s.EAVSubscribeBeforeView(func(viewName string) error {
+			r.stageUpdate(&ViewUpdate{viewName})
+			return nil
+		}, false, "todos", "messages", "topics", "reactions")
+
+		s.EAVSubscribeAfterView(func(viewName string) {
+			r.wakeReminders()
+		}, false, "todos")
+
+		s.EAVSubscribeAfterEntity(func(viewName string, groupID, id ids.ID) {
+			if err := r.removeDuplicateOccurrences(s, groupID, id); err != nil {
+				r.log.Warnf("error removing duplicate occurrences %#v", err)
+			}
+		}, false, "todos")
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.forwardUpdates(s)
+	return s, nil
+}
+
+// Executes a SQL statement template within a migration. Templates can use `index_where` and `selectors`
+// to refer to the underlying EAV data for a view.
+func execTemplate(s *slick.Slick, tx *sql.Tx, statement string) error {
+	statementTmpl, err := template.New("index_statement").
+		Funcs(template.FuncMap{
+			"index_where": func(viewName, prefix string) (string, error) {
+				return s.EAVIndexWhere(viewName, prefix)
+			},
+			"selectors": func(viewName, prefix string, colName ...string) (string, error) {
+				return s.EAVSelectors(viewName, prefix, colName...)
+			},
+		}).Parse(statement)
+	if err != nil {
+		return err
+	}
+	var t bytes.Buffer
+	if err := statementTmpl.Execute(&t, nil); err != nil {
+		return err
+	}
+	_, err = tx.Exec(t.String())
+	return err
+}
+
+// Passes updates from slick through to Roost subscriptions until slick is shut down.
+func (r *Roost) forwardUpdates(s *slick.Slick) {
+	u := s.Updates()
+	go func() {
+		for i := range u {
+			if update, ok := i.(*slick.GroupUpdate); ok && update.GroupState == messaging.GroupStateSynced {
+				if err := r.shareProfileOnce(s, update.ID); err != nil {
+					r.log.Warnf("error sharing profile %#v", err)
+				}
+			}
+			r.publish(i)
+		}
+	}()
+}
+
+// Makes a Roost instance for a given root directory.
+func MakeRoost(root, heyaAuthToken string) (*Roost, error) {
+	return MakeRoostWithKeyMaker(root, heyaAuthToken, func(r *Roost, p string) ([]byte, error) {
+		return r.slick.NewKey(p)
+	})
+}
+
+// Makes a Roost instance for a given root directory.
+func MakeRoostWithStrongKey(root, heyaAuthToken string) (*Roost, error) {
+	return MakeRoostWithKeyMaker(root, heyaAuthToken, func(r *Roost, p string) ([]byte, error) {
+		return []byte(p), nil
+	})
+}
+
+// Get current transport states
+func (r *Roost) TransportStates() *TransportStates {
+	return makeTransportStates(r.slick.TransportStates())
+}
+
+// Generates a random 6-digit pin
+func (r *Roost) NewPin() (string, error) {
+	return slick.NewPin()
+}
+
+// Get the underlying Slick instance
+func (r *Roost) Slick() *slick.Slick {
+	return r.slick
+}
+
+// Gets a device link which can be used to link a device to the current device group.
+func (r *Roost) GetDeviceLink() (string, error) {
+	link, err := r.slick.DeviceGroup.GetDeviceLink()
+	if err != nil {
+		return "", err
+	}
+	return slick.SerializeDeviceInvite(link)
+}
+
+// Links a device using the provided device link.
+func (r *Roost) LinkDevice(l string) error {
+	link, err := slick.DeserializeDeviceInvite(l)
+	if err != nil {
+		return err
+	}
+	return r.slick.DeviceGroup.LinkDevice(link)
+}
+
+// Accepts an invite.
+func (r *Roost) AcceptInvite(inviteURL string, password string) ([]byte, error) {
+	parsed, err := url.Parse(inviteURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "roost" {
+		return nil, fmt.Errorf("expected scheme roost, got %s", parsed.Scheme)
+	}
+	if parsed.Host != "invite" {
+		return nil, fmt.Errorf("expected host to be 'invite', got %s", parsed.Host)
+	}
+	invite, err := slick.DeserializeInvite(parsed.Path[1:])
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.slick.AcceptInvite(invite, password)
+	return id[:], err
+}
+
+// Creates a roost group (a "roost")
+func (r *Roost) CreateGroup(name string) (*RoostGroup, error) {
+	groupID, err := r.slick.CreateGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	group, err := makeRoostGroup(r, groupID[:])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := group.CreateTopic("home"); err != nil {
+		return nil, err
+	}
+	if err := r.shareProfileOnce(r.slick, groupID); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// Gets a group for a specific id.
+func (r *Roost) Group(groupID []byte) (*RoostGroup, error) {
+	return makeRoostGroup(r, groupID)
+}
+
+// Gets a list of available groups.
+func (r *Roost) Groups() (*Groups, error) {
+	groups, err := r.slick.Groups()
+
+	if err != nil {
+		return nil, err
+	}
+
+	roostGroups := make([]*RoostGroup, 0, len(groups))
+	for _, group := range groups {
+		if group.State != messaging.GroupStateSynced {
+			continue
+		}
+		roostGroup, err := r.Group(group.ID[:])
+
+		if err != nil {
+			return nil, err
+		}
+		roostGroups = append(roostGroups, roostGroup)
+	}
+	return &Groups{len(roostGroups), roostGroups}, nil
+}
+
+// Gets messages. Clients should wait for an UpdateMessagesFetched event and shutdown after that.
+func (r *Roost) GetMessages(password string) error {
+	key, err := r.keyMaker(r, password)
+	if err != nil {
+		return err
+	}
+	return r.slick.GetMessages(key)
+}
+
+// Initializes roost with a given password.
+func (r *Roost) Initialize(password string) error {
+	key, err := r.keyMaker(r, password)
+	if err != nil {
+		return err
+	}
+	if err := r.slick.Initialize(key); err != nil {
+		return err
+	}
+	r.keyDigest = sha256.Sum256(key)
+	if r.heyaAuthToken != "" {
+		if err := r.RegisterHeyaTransport(r.heyaAuthToken, "heya.meow.io", 8337); err != nil {
+			return err
+		}
+	}
+	if err := r.updateState(); err != nil {
+		return err
+	}
+	r.startReminders()
+	return nil
+}
+
+// Unlocks an already initialized roost with a given password.
+func (r *Roost) Unlock(password string) error {
+	key, err := r.keyMaker(r, password)
+	if err != nil {
+		return err
+	}
+	if err := r.slick.Open(key); err != nil {
+		return err
+	}
+	r.keyDigest = sha256.Sum256(key)
+	if err := r.updateState(); err != nil {
+		return err
+	}
+	r.startReminders()
+	return nil
+}
+
+// Changes the password protecting the database. The database is re-encrypted into a new file which only
+// replaces the existing one once it has been completely written, so an interruption part way through leaves
+// the database readable with the old password.
+func (r *Roost) ChangePassword(oldPassword, newPassword string) error {
+	oldKey, err := r.keyMaker(r, oldPassword)
+	if err != nil {
+		return err
+	}
+	newKey, err := r.keyMaker(r, newPassword)
+	if err != nil {
+		return err
+	}
+	if len(newKey) != 32 {
+		return fmt.Errorf("expected key of length 32, got %d", len(newKey))
+	}
+
+	running := r.slick.Running()
+	if running {
+		digest := sha256.Sum256(oldKey)
+		if subtle.ConstantTimeCompare(digest[:], r.keyDigest[:]) != 1 {
+			return errors.New("old password is incorrect")
+		}
+		r.stopReminders()
+		if err := r.slick.Shutdown(); err != nil {
+			return err
+		}
+		r.forwardUpdates(r.slick)
+	}
+
+	key := newKey
+	rekeyErr := rekeyDatabase(filepath.Join(r.root, databaseFilename), oldKey, newKey)
+	if rekeyErr != nil {
+		key = oldKey
+	}
+	if running {
+		if err := r.slick.Open(key); err != nil {
+			return err
+		}
+		r.keyDigest = sha256.Sum256(key)
+		if err := r.updateState(); err != nil {
+			return err
+		}
+		r.startReminders()
+	}
+	return rekeyErr
+}
+
+// Exports the database at path into a new file encrypted with newKey and then atomically moves it into place.
+func rekeyDatabase(path string, oldKey, newKey []byte) error {
+	rekeyPath := path + rekeySuffix
+	if err := os.RemoveAll(rekeyPath); err != nil {
+		return err
+	}
+
+	conn, err := sql.Open("sqlite3_slick", fmt.Sprintf("file:%s?_pragma_key=x'%x'", url.PathEscape(path), oldKey))
+	if err != nil {
+		return err
+	}
+	conn.SetMaxOpenConns(1)
+	if err := func() error {
+		if _, err := conn.Exec("SELECT count(*) FROM sqlite_master"); err != nil {
+			return fmt.Errorf("unable to read database with old password: %w", err)
+		}
+		if _, err := conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return err
+		}
+		if _, err := conn.Exec(fmt.Sprintf(`ATTACH DATABASE '%s' AS rekeyed KEY "x'%x'"`, strings.ReplaceAll(rekeyPath, "'", "''"), newKey)); err != nil {
+			return err
+		}
+		if _, err := conn.Exec("PRAGMA rekeyed.auto_vacuum = 2"); err != nil {
+			return err
+		}
+		if _, err := conn.Exec("SELECT sqlcipher_export('rekeyed')"); err != nil {
+			return err
+		}
+		_, err := conn.Exec("DETACH DATABASE rekeyed")
+		return err
+	}(); err != nil {
+		_ = conn.Close()
+		_ = os.RemoveAll(rekeyPath)
+		return err
+	}
+	if err := conn.Close(); err != nil {
+		_ = os.RemoveAll(rekeyPath)
+		return err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(rekeyPath, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+		return err
+	}
+	return dir.Close()
+}
+
+// Shuts down an existing roost instance.
+func (r *Roost) Shutdown() error {
+	r.State = StateLocked
+	r.stopReminders()
+	return r.slick.Shutdown()
+}
+
+// Sets the current device name and type for a given roost instance.
+func (r *Roost) SetDeviceNameType(name, ty string) error {
+	return r.slick.DeviceGroup.SetNameType(name, ty)
+}
+
+// Sets the name and avatar shown next to the things I write. The profile is shared with every group I'm in,
+// including groups created or joined later, and with my other devices. A nil avatar removes the avatar.
+func (r *Roost) SetProfile(name string, avatar []byte) error {
+	deviceGroup, err := r.slick.Group(r.slick.DeviceGroup.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(r.slick, deviceGroup, name, avatar); err != nil {
+		return err
+	}
+	groups, err := r.slick.Groups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if group.State != messaging.GroupStateSynced {
+			continue
+		}
+		if err := writeProfile(r.slick, group, name, avatar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gets my profile. If no profile has been set, the profile has an empty name and no avatar.
+func (r *Roost) Profile() (*Profile, error) {
+	deviceGroup, err := r.slick.Group(r.slick.DeviceGroup.ID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ownProfile(r.slick, deviceGroup)
+	if err != nil || p != nil {
+		return p, err
+	}
+	return &Profile{}, nil
+}
+
+// Gets the latest profile written by this identity to a group, or nil if there isn't one.
+func ownProfile(s *slick.Slick, group *slick.Group) (*Profile, error) {
+	p := Profile{}
+	if err := s.EAVGet(&p, "select * from profiles where group_id = ? AND _identity_tag = ? order by _mtime desc, id desc limit 1", group.ID[:], group.IdentityTag[:]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Writes my profile to a group unless it's already up to date.
+func writeProfile(s *slick.Slick, group *slick.Group, name string, avatar []byte) error {
+	existing, err := ownProfile(s, group)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Name == name && bytes.Equal(existing.Avatar, avatar) {
+		return nil
+	}
+	values := map[string]interface{}{
+		"name":   name,
+		"avatar": nil,
+	}
+	if len(avatar) != 0 {
+		values["avatar"] = avatar
+	}
+	writer := s.EAVWriter(group)
+	if existing == nil {
+		writer.Insert("profiles", values)
+	} else {
+		writer.Update("profiles", existing.ID, values)
+	}
+	return writer.Execute()
+}
+
+// Shares my profile with a group the first time it's synced since starting. Later changes to the profile are written to
+// every synced group by SetProfile, so groups which have already been shared with aren't checked again.
+func (r *Roost) shareProfileOnce(s *slick.Slick, groupID ids.ID) error {
+	r.profilesLock.Lock()
+	defer r.profilesLock.Unlock()
+	if r.profileShared[groupID] {
+		return nil
+	}
+	if err := shareProfile(s, groupID); err != nil {
+		return err
+	}
+	r.profileShared[groupID] = true
+	return nil
+}
+
+// Shares my profile with a group which was created or joined after it was set.
+func shareProfile(s *slick.Slick, groupID ids.ID) error {
+	if groupID == s.DeviceGroup.ID {
+		return nil
+	}
+	deviceGroup, err := s.Group(s.DeviceGroup.ID)
+	if err != nil {
+		return err
+	}
+	p, err := ownProfile(s, deviceGroup)
+	if err != nil || p == nil {
+		return err
+	}
+	group, err := s.Group(groupID)
+	if err != nil {
+		return err
+	}
+	return writeProfile(s, group, p.Name, p.Avatar)
+}
+
+// Gets a list of all connected devices to the current identity which haven't left the device group.
+func (r *Roost) Devices() (*Devices, error) {
+	deviceGroup, err := r.slick.Group(r.slick.DeviceGroup.ID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.slick.DeviceGroup.Devices()
+	if err != nil {
+		return nil, err
+	}
+	var removals []*deviceRemoval
+	if err := r.slick.EAVSelect(&removals, "select * from device_removals where group_id = ?", deviceGroup.ID[:]); err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(d))
+	for _, device := range d {
+		device := device
+		if departed(device, removals) {
+			continue
+		}
+		current := bytes.Equal(device.IdentityID, deviceGroup.IdentityTag[:]) && bytes.Equal(device.MembershipID, deviceGroup.MembershipTag[:])
+		devices = append(devices, &Device{device, current})
+	}
+	return &Devices{len(devices), devices}, nil
+}
+
+// Only removals written by the device itself, with LeaveDeviceGroup, count as departures.
+func departed(device *slick.Device, removals []*deviceRemoval) bool {
+	for _, dr := range removals {
+		if bytes.Equal(dr.DeviceIdentityTag, device.IdentityID) && bytes.Equal(dr.DeviceMembershipTag, device.MembershipID) &&
+			bytes.Equal(dr.IdentityID, device.IdentityID) && bytes.Equal(dr.MembershipID, device.MembershipID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Registers the HEYA transport which is the main transport used currently for Roost. This transport
+// supports the sending of iOS push notifications.
+func (r *Roost) RegisterHeyaTransport(authToken, host string, port int) error {
+	return r.slick.RegisterHeyaTransport(authToken, host, port)
+}
+
+// Gets a subscription to events which can occur within the application. For example application state changes
+// and updates to specific tables within the EAV database.
+//
+// This subscription will provide the following types:
+//
+//		*AppState: an update about the current state of Roost
+//	  *GroupUpdate: an update about a group
+//	  *TableUpdate: an update about a specific table within roost, for instance `todos`, `topics` or `messages`.
+//
+// Each call returns an independent subscription to every update. Use Subscribe to only receive some updates.
+func (r *Roost) Updates() *Updates {
+	return r.Subscribe(nil)
+}
+
+// Subscribes to the updates matching a filter, or to every update if the filter is nil. Updates which occur before
+// the first subscription are held until it is made. Call Close on the subscription once it is no longer needed.
+func (r *Roost) Subscribe(filter *UpdateFilter) *Updates {
+	u := &Updates{
+		filter: filter,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		roost:  r,
+	}
+	r.subscriptionsLock.Lock()
+	defer r.subscriptionsLock.Unlock()
+	r.subscriptions = append(r.subscriptions, u)
+	if !r.subscribed {
+		r.subscribed = true
+		for _, item := range r.heldUpdates {
+			if filter.matches(item) {
+				u.enqueue(item)
+			}
+		}
+		r.heldUpdates = nil
+	}
+	return u
+}
+
+func (r *Roost) unsubscribe(u *Updates) {
+	r.subscriptionsLock.Lock()
+	defer r.subscriptionsLock.Unlock()
+	if i := slices.Index(r.subscriptions, u); i != -1 {
+		r.subscriptions = slices.Delete(r.subscriptions, i, i+1)
 	}
-	return slick.SerializeDeviceInvite(link)
 }
 
-// Links a device using the provided device link.
-func (r *Roost) LinkDevice(l string) error {
-	link, err := slick.DeserializeDeviceInvite(l)
+// Records an update to publish if the current transaction commits.
+func (r *Roost) stageUpdate(item interface{}) {
+	r.stagedUpdates = append(r.stagedUpdates, item)
+}
+
+// Registers the entity change trigger function and the hooks publishing staged updates on commit.
+func (r *Roost) registerConnectionHooks(s *slick.Slick) error {
+	conn, err := s.DB.DB().Conn(context.Background())
 	if err != nil {
 		return err
 	}
-	return r.slick.DeviceGroup.LinkDevice(link)
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected database connection %T", driverConn)
+		}
+		if err := sqliteConn.RegisterFunc("roost_entity_change", r.recordEntityChange, false); err != nil {
+			return err
+		}
+		sqliteConn.RegisterCommitHook(func() int {
+			for _, item := range r.stagedUpdates {
+				r.publish(item)
+			}
+			r.stagedUpdates = nil
+			r.entityChanges = nil
+			return 0
+		})
+		sqliteConn.RegisterRollbackHook(func() {
+			r.stagedUpdates = nil
+			r.entityChanges = nil
+		})
+		return nil
+	})
 }
 
-// Accepts an invite.
-func (r *Roost) AcceptInvite(inviteURL string, password string) ([]byte, error) {
-	parsed, err := url.Parse(inviteURL)
-	if err != nil {
-		return nil, err
-	}
-	if parsed.Scheme != "roost" {
-		return nil, fmt.Errorf("expected scheme roost, got %s", parsed.Scheme)
+// The values of an entity before its first change and after its last change within a transaction.
+type entityChange struct {
+	existed   bool
+	exists    bool
+	oldValues map[string]interface{}
+	newValues map[string]interface{}
+}
+
+// Called by triggers with an entity's liveness before and after a change, then each column's name, old and new value.
+func (r *Roost) recordEntityChange(viewName string, groupID, id []byte, existed, exists bool, columns ...interface{}) (int64, error) {
+	if len(columns)%3 != 0 {
+		return 0, fmt.Errorf("expected a name, old value and new value for each column, got %d values", len(columns))
 	}
-	if parsed.Host != "invite" {
-		return nil, fmt.Errorf("expected host to be 'invite', got %s", parsed.Host)
+	key := entityChangeKey(viewName, groupID, id)
+	change, ok := r.entityChanges[key]
+	if !ok {
+		change = &entityChange{existed: existed, oldValues: make(map[string]interface{}, len(columns)/3)}
+		for i := 0; i != len(columns); i += 3 {
+			change.oldValues[fmt.Sprint(columns[i])] = columns[i+1]
+		}
+		if r.entityChanges == nil {
+			r.entityChanges = make(map[string]*entityChange)
+		}
+		r.entityChanges[key] = change
 	}
-	invite, err := slick.DeserializeInvite(parsed.Path[1:])
-	if err != nil {
-		return nil, err
+	change.exists = exists
+	change.newValues = make(map[string]interface{}, len(columns)/3)
+	for i := 0; i != len(columns); i += 3 {
+		change.newValues[fmt.Sprint(columns[i])] = columns[i+2]
 	}
-	id, err := r.slick.AcceptInvite(invite, password)
-	return id[:], err
+	return 0, nil
 }
 
-// Creates a roost group (a "roost")
-func (r *Roost) CreateGroup(name string) (*RoostGroup, error) {
-	groupID, err := r.slick.CreateGroup(name)
-	if err != nil {
-		return nil, err
+// Works out how an entity changed within the current transaction, or nil if it didn't.
+func (r *Roost) entityUpdate(viewName string, groupID, id []byte) *EntityUpdate {
+	key := entityChangeKey(viewName, groupID, id)
+	change, ok := r.entityChanges[key]
+	if !ok {
+		return nil
 	}
-	group, err := makeRoostGroup(r, groupID[:])
-	if err != nil {
-		return nil, err
+	delete(r.entityChanges, key)
+	update := &EntityUpdate{ViewName: viewName, GroupID: groupID, EntityID: id}
+	if viewName == "reactions" {
+		update.TargetID, _ = change.newValues["entity_id"].([]byte)
 	}
-	if _, err := group.CreateTopic("home"); err != nil {
-		return nil, err
+	switch {
+	case !change.existed && !change.exists:
+		return nil
+	case !change.existed:
+		update.Kind = EntityInserted
+	case !change.exists:
+		update.Kind = EntityDeleted
+	default:
+		update.Kind = EntityUpdated
+		update.changedColumns = make([]string, 0)
+		for column, value := range change.newValues {
+			if !sameValue(value, change.oldValues[column]) {
+				update.changedColumns = append(update.changedColumns, column)
+			}
+		}
+		sort.Strings(update.changedColumns)
+		update.ChangedColumnCount = len(update.changedColumns)
 	}
+	return update
+}
 
-	return group, nil
+func entityChangeKey(viewName string, groupID, id []byte) string {
+	return viewName + "/" + string(groupID) + "/" + string(id)
 }
 
-// Gets a group for a specific id.
-func (r *Roost) Group(groupID []byte) (*RoostGroup, error) {
-	return makeRoostGroup(r, groupID)
+func sameValue(a, b interface{}) bool {
+	aBytes, aIsBytes := a.([]byte)
+	bBytes, bIsBytes := b.([]byte)
+	if aIsBytes || bIsBytes {
+		return aIsBytes && bIsBytes && bytes.Equal(aBytes, bBytes)
+	}
+	return a == b
 }
 
-// Gets a list of available groups.
-func (r *Roost) Groups() (*Groups, error) {
-	groups, err := r.slick.Groups()
+// Queues an update for every subscription whose filter matches it.
+func (r *Roost) publish(item interface{}) {
+	r.subscriptionsLock.Lock()
+	defer r.subscriptionsLock.Unlock()
+	if !r.subscribed {
+		if len(r.heldUpdates) < maxQueuedUpdates {
+			r.heldUpdates = append(r.heldUpdates, item)
+		} else {
+			r.log.Warnf("update dropped before first subscription %#v", item)
+		}
+		return
+	}
+	for _, u := range r.subscriptions {
+		if u.filter.matches(item) {
+			u.enqueue(item)
+		}
+	}
+}
+
+// Return the number of unread messages across all topics and groups
+func (r *Roost) UnreadMessageCount() (int64, error) {
+	var unreadCount int64
+	if err := r.slick.EAVGet(&unreadCount, `select sum(unread_count) from (
+		select count(*) as unread_count from messages m inner join topics t on m.group_id = t.group_id and m.topic_id = t.id where m._ctime > t.message_last_read and m.deleted = 0 and t.archived = 0 and t.deleted = 0
+	)`); err != nil {
+		return 0, err
+	}
+	return unreadCount, nil
+}
 
+// Gets incomplete todos across all groups which are due between start and end inclusive, ordered by when they are due.
+// Times are in seconds since the Unix epoch.
+func (r *Roost) TodosDueBetween(start, end float64) (*TodoList, error) {
+	groups, err := r.slick.Groups()
 	if err != nil {
 		return nil, err
 	}
+	groupIDs := make([]interface{}, 0, len(groups))
+	for _, group := range groups {
+		if group.State == messaging.GroupStateSynced {
+			groupIDs = append(groupIDs, group.ID[:])
+		}
+	}
+	todos := make([]*Todo, 0)
+	if len(groupIDs) == 0 {
+		return &TodoList{0, todos}, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(groupIDs)), ", ")
+	args := append(groupIDs, start, end)
+	if err := r.slick.EAVSelect(&todos, todoSelect+" where group_id in ("+placeholders+") AND due_at != 0 AND due_at >= ? AND due_at <= ? AND deleted = 0 AND completed_at = 0 order by due_at, id", args...); err != nil {
+		return nil, err
+	}
+	return &TodoList{len(todos), todos}, nil
+}
 
-	roostGroups := make([]*RoostGroup, 0, len(groups))
+// Gets incomplete todos across all groups which are assigned to you, ordered by group and position.
+func (r *Roost) TodosAssignedToMe() (*TodoList, error) {
+	groups, err := r.slick.Groups()
+	if err != nil {
+		return nil, err
+	}
+	todos := make([]*Todo, 0)
 	for _, group := range groups {
 		if group.State != messaging.GroupStateSynced {
 			continue
 		}
-		roostGroup, err := r.Group(group.ID[:])
-
-		if err != nil {
+		var groupTodos []*Todo
+		if err := r.slick.EAVSelect(&groupTodos, todoSelect+" where group_id = ? AND assignee = ? AND deleted = 0 AND completed_at = 0 order by position, id", group.ID[:], group.IdentityTag[:]); err != nil {
 			return nil, err
 		}
-		roostGroups = append(roostGroups, roostGroup)
+		todos = append(todos, groupTodos...)
 	}
-	return &Groups{len(roostGroups), roostGroups}, nil
+	return &TodoList{len(todos), todos}, nil
 }
 
-// Gets messages. Clients should wait for an UpdateMessagesFetched event and shutdown after that.
-func (r *Roost) GetMessages(password string) error {
-	key, err := r.keyMaker(r, password)
+// Leave a device group and destroy all Roost data on this device, returning it to a "new" state.
+func (r *Roost) LeaveDeviceGroup() error {
+	r.destroyLock.Lock()
+	defer r.destroyLock.Unlock()
+
+	if r.slick.Running() {
+		if err := r.announceDeparture(); err != nil {
+			return err
+		}
+	}
+	return r.destroy()
+}
+
+func (r *Roost) destroy() error {
+	r.stopReminders()
+	if err := r.slick.Shutdown(); err != nil {
+		return err
+	}
+	if err := shredData(r.root); err != nil {
+		return err
+	}
+	s, err := r.makeSlick()
 	if err != nil {
 		return err
 	}
-	return r.slick.GetMessages(key)
+	r.slick = s
+	r.State = StateNew
+	r.publish(&slick.AppState{State: slick.StateNew})
+	return nil
 }
 
-// Initializes roost with a given password.
-func (r *Roost) Initialize(password string) error {
-	key, err := r.keyMaker(r, password)
+// Records the removal of this device within the device group and waits, up to departureTimeout, for the group
+// update acknowledging it.
+func (r *Roost) announceDeparture() error {
+	deviceGroup, err := r.slick.Group(r.slick.DeviceGroup.ID)
 	if err != nil {
 		return err
 	}
-	if err := r.slick.Initialize(key); err != nil {
+	filter := &UpdateFilter{GroupID: deviceGroup.ID[:]}
+	filter.AddType(UpdateGroupUpdate)
+	updates := r.Subscribe(filter)
+	defer updates.Close()
+
+	writer := r.slick.EAVWriter(deviceGroup)
+	writer.Insert("device_removals", map[string]interface{}{
+		"device_identity_tag":   deviceGroup.IdentityTag[:],
+		"device_membership_tag": deviceGroup.MembershipTag[:],
+	})
+	if err := writer.Execute(); err != nil {
 		return err
 	}
-	if r.heyaAuthToken != "" {
-		if err := r.RegisterHeyaTransport(r.heyaAuthToken, "heya.meow.io", 8337); err != nil {
+
+	state, err := r.slick.GroupState(deviceGroup.ID)
+	if err != nil {
+		return err
+	}
+	timer := time.AfterFunc(departureTimeout, updates.Close)
+	defer timer.Stop()
+	for !departureAcknowledged(state) {
+		updates.Next()
+		if updates.Type() == UpdateFinished {
+			r.log.Warnf("timed out waiting for device group to acknowledge departure")
+			return nil
+		}
+		state = updates.item.(*slick.GroupUpdate)
+	}
+	return nil
+}
+
+func departureAcknowledged(state *slick.GroupUpdate) bool {
+	return state.PendingMessageCount == 0 && state.AckedMemberCount == state.MemberCount
+}
+
+// Overwrites the database and key material beneath root with zeros before removing them. Other files in root, which
+// may belong to the application, are left alone.
+func shredData(root string) error {
+	database := filepath.Join(root, databaseFilename)
+	for _, path := range []string{
+		database,
+		database + "-wal",
+		database + "-shm",
+		database + rekeySuffix,
+		database + rekeySuffix + "-wal",
+		database + rekeySuffix + "-shm",
+		filepath.Join(root, saltFilename),
+	} {
+		if err := shredFile(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err := os.Remove(path); err != nil {
 			return err
 		}
 	}
-	return r.updateState()
+	return nil
 }
 
-// Unlocks an already initialized roost with a given password.
-func (r *Roost) Unlock(password string) error {
-	key, err := r.keyMaker(r, password)
+func shredFile(path string) error {
+	// the salt is created read only
+	if err := os.Chmod(path, 0o600); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304
 	if err != nil {
 		return err
 	}
-	if err := r.slick.Open(key); err != nil {
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
 		return err
 	}
-	return r.updateState()
-}
-
-// Shuts down an existing roost instance.
-func (r *Roost) Shutdown() error {
-	r.State = StateLocked
-	return r.slick.Shutdown()
+	zeros := make([]byte, 64*1024)
+	for remaining := info.Size(); remaining > 0; remaining -= int64(len(zeros)) {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
 }
 
-// Sets the current device name and type for a given roost instance.
-func (r *Roost) SetDeviceNameType(name, ty string) error {
-	return r.slick.DeviceGroup.SetNameType(name, ty)
+// Emits an update for each todo reminder as it comes due while Roost is running. Reminders which came due while
+// Roost was locked are emitted once it's unlocked.
+type reminderScheduler struct {
+	stop chan struct{}
+	done chan struct{}
 }
 
-// Gets a list of all connected devices to the current identity.
-func (r *Roost) Devices() (*Devices, error) {
-	d, err := r.slick.DeviceGroup.Devices()
-	if err != nil {
-		return nil, err
+func (r *Roost) startReminders() {
+	r.remindersLock.Lock()
+	defer r.remindersLock.Unlock()
+	if r.reminders != nil || !r.slick.Running() {
+		return
 	}
-	return &Devices{len(d), d}, nil
+	rs := &reminderScheduler{make(chan struct{}), make(chan struct{})}
+	r.reminders = rs
+	go r.runReminders(rs)
 }
 
-// Registers the HEYA transport which is the main transport used currently for Roost. This transport
-// supports the sending of iOS push notifications.
-func (r *Roost) RegisterHeyaTransport(authToken, host string, port int) error {
-	return r.slick.RegisterHeyaTransport(authToken, host, port)
+func (r *Roost) stopReminders() {
+	r.remindersLock.Lock()
+	defer r.remindersLock.Unlock()
+	if r.reminders == nil {
+		return
+	}
+	close(r.reminders.stop)
+	<-r.reminders.done
+	r.reminders = nil
 }
 
-// Gets a channel of events which can occur within the application. For example application state changes
-// and updates to specific tables within the EAV database.
-//
-// This channel will provide the following types:
-//
-//		*AppState: an update about the current state of Roost
-//	  *GroupUpdate: an update about a group
-//	  *TableUpdate: an update about a specific table within roost, for instance `todos`, `topics` or `messages`.
-func (r *Roost) Updates() *Updates {
-	return &Updates{r.updates, nil}
+// Causes the reminder scheduler to recalculate when the next reminder is due.
+func (r *Roost) wakeReminders() {
+	select {
+	case r.reminderWake <- struct{}{}:
+	default:
+	}
 }
 
-// Return the number of unread messages across all topics and groups
-func (r *Roost) UnreadMessageCount() (int64, error) {
-	var unreadCount int64
-	if err := r.slick.EAVGet(&unreadCount, `select sum(unread_count) from (
-		select count(*) as unread_count from messages m inner join topics t on m.group_id = t.group_id and m.topic_id = t.id where m._ctime > t.message_last_read
-	)`); err != nil {
-		return 0, err
+func (r *Roost) runReminders(rs *reminderScheduler) {
+	defer close(rs.done)
+	var lastCheck float64
+	if err := r.slick.DB.Run("get reminder check", func() error {
+		return r.slick.DB.Tx.Get(&lastCheck, "SELECT checked_at FROM reminder_checks")
+	}); err != nil {
+		r.log.Warnf("error getting last reminder check %#v", err)
+		lastCheck = now()
 	}
-	return unreadCount, nil
-}
+	for {
+		var timer <-chan time.Time
+		var next *float64
+		if err := r.slick.EAVGet(&next, "select min(remind_at) from todos where remind_at > ? AND deleted = 0 AND completed_at = 0", lastCheck); err != nil {
+			r.log.Warnf("error getting next reminder %#v", err)
+		} else if next != nil {
+			timer = time.After(time.Until(time.UnixMicro(int64(*next * 1000000))))
+		}
 
-// Leave a device group and destroy all Roost data on this device, returning it to a "new" state.
-func (r *Roost) LeaveDeviceGroup() error {
-	// TODO: still needs to be implemented
-	return nil
+		select {
+		case <-rs.stop:
+			return
+		case <-r.reminderWake:
+			continue
+		case <-timer:
+		}
+
+		checkTs := now()
+		var todos []*Todo
+		err := r.slick.EAVSelect(&todos, "select * from todos where remind_at > ? AND remind_at <= ? AND deleted = 0 AND completed_at = 0 order by remind_at, id", lastCheck, checkTs)
+		lastCheck = checkTs
+		if err != nil {
+			r.log.Warnf("error getting due reminders %#v", err)
+			continue
+		}
+		for _, todo := range todos {
+			r.publish(&ReminderUpdate{todo.GroupID, todo.ID, todo.TopicID, todo.Body, todo.DueAt, todo.RemindAt})
+		}
+		if err := r.slick.DB.Run("save reminder check", func() error {
+			_, err := r.slick.DB.Tx.Exec("UPDATE reminder_checks SET checked_at = ?", checkTs)
+			return err
+		}); err != nil {
+			r.log.Warnf("error saving reminder check %#v", err)
+		}
+	}
 }
 
 // Adds a push notification token to Roost.
@@ -950,78 +2957,312 @@ func (r *Roost) updateState() error {
 	}
 }
 
-// Perform a fulltext search across all your Roosts.
+// Perform a fulltext search within a group, or across all your Roosts if groupID is nil.
 func (r *Roost) Search(groupID []byte, term, highlightStart, highlightEnd string) (*SearchResults, error) {
+	return r.SearchWithQuery(&SearchQuery{
+		GroupID:        groupID,
+		Term:           term,
+		HighlightStart: highlightStart,
+		HighlightEnd:   highlightEnd,
+	})
+}
+
+// Perform a search using a structured query. Returns a *SearchQueryError if the term can't be searched for.
+func (r *Roost) SearchWithQuery(query *SearchQuery) (*SearchResults, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	search, err := parseUserSearch(query.Term)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := parseSearchCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	groupNames, err := r.groupNames()
+	if err != nil {
+		return nil, err
+	}
+	q := *query
+	q.search = search
 	var results *SearchResults
 	return results, r.slick.DB.Run("search", func() error {
-		var err error
-		resultList, err := r.generateResultsGroup(groupID, term, highlightStart, highlightEnd, 0)
+		if cursor == nil {
+			cursor = &searchCursor{}
+			if err := r.slick.DB.Tx.Get(&cursor.MaxRowID, "SELECT coalesce(max(id), 0) FROM fs_contents"); err != nil {
+				return err
+			}
+		}
+		resultList, nextCursor, err := r.generateResultsGroup(&q, cursor)
 		if err != nil {
 			return err
 		}
-		total, err := r.generateTotal(term)
+		total, err := r.generateTotal(&q, cursor)
 		if err != nil {
 			return err
 		}
+		setGroupNames(resultList, groupNames)
 		results = &SearchResults{
-			GroupID:        groupID,
-			Term:           term,
-			Offset:         0,
-			HighlightStart: highlightStart,
-			HighlightEnd:   highlightEnd,
+			GroupID:        q.GroupID,
+			Term:           q.Term,
+			HighlightStart: q.HighlightStart,
+			HighlightEnd:   q.HighlightEnd,
 			Total:          total,
 			Count:          len(resultList),
+			AtEnd:          nextCursor == nil,
 			results:        resultList,
+			query:          &q,
 		}
-		return nil
+		if nextCursor != nil {
+			results.Cursor, err = nextCursor.encode()
+		}
+		return err
 	})
 }
 
 // Fetch the next page of results from a previous search.
 func (r *Roost) NextPage(results *SearchResults) (*SearchResults, error) {
-	newOffset := results.Offset + PageSize
-	resultList, err := r.generateResultsGroup(results.GroupID, results.Term, results.HighlightStart, results.HighlightEnd, newOffset)
+	if results.AtEnd {
+		return &SearchResults{
+			GroupID:        results.GroupID,
+			Term:           results.Term,
+			HighlightStart: results.HighlightStart,
+			HighlightEnd:   results.HighlightEnd,
+			Total:          results.Total,
+			AtEnd:          true,
+			results:        []*Result{},
+			query:          results.query,
+		}, nil
+	}
+	q := *results.query
+	q.Cursor = results.Cursor
+	return r.SearchWithQuery(&q)
+}
+
+// Gets the names of all groups keyed by group id.
+func (r *Roost) groupNames() (map[ids.ID]string, error) {
+	groups, err := r.slick.Groups()
 	if err != nil {
 		return nil, err
 	}
-	results.results = resultList
-	results.Count = len(resultList)
-	results.Offset = newOffset
-	return results, nil
+	names := make(map[ids.ID]string, len(groups))
+	for _, group := range groups {
+		names[group.ID] = group.Name
+	}
+	return names, nil
+}
+
+func setGroupNames(results []*Result, groupNames map[ids.ID]string) {
+	for _, result := range results {
+		result.GroupName = groupNames[ids.IDFromBytes(result.GroupID)]
+	}
+}
+
+func (q *SearchQuery) validate() error {
+	if q.Type != "" && q.Type != "todo" && q.Type != "message" && q.Type != "topic" {
+		return fmt.Errorf("expected type to be todo, message or topic, got %s", q.Type)
+	}
+	if q.Order != SearchOrderRelevance && q.Order != SearchOrderRecency {
+		return fmt.Errorf("unknown search order %d", q.Order)
+	}
+	if q.Completion != SearchCompletionAny && q.Completion != SearchCompletionIncomplete && q.Completion != SearchCompletionComplete {
+		return fmt.Errorf("unknown search completion %d", q.Completion)
+	}
+	return nil
+}
+
+// Chooses the full-text index used to find the search terms and gets the query for it. Returns an empty index name
+// if there are no terms or if they have to be found by scanning every row.
+func (q *SearchQuery) ftsIndex() (string, string) {
+	if q.search == nil {
+		return "", ""
+	}
+	if !q.search.unsegmented() {
+		return "fs_content_fts_idx", q.search.wordQuery()
+	}
+	if query, ok := q.search.trigramQuery(); ok {
+		return "fs_content_trigram_idx", query
+	}
+	return "", ""
+}
+
+// Builds the from and where clauses shared by search results and totals, so the total always counts the results
+// being paged.
+func (q *SearchQuery) clauses(cursor *searchCursor) (string, []string, []interface{}) {
+	from := "fs_contents c"
+	conditions := []string{"c.id <= ?"}
+	args := []interface{}{cursor.MaxRowID}
+	if index, match := q.ftsIndex(); index != "" {
+		from = index + " JOIN fs_contents c ON c.id = " + index + ".rowid"
+		conditions = append(conditions, index+".text MATCH ?")
+		args = append(args, match)
+	} else if q.search != nil {
+		likeConditions, likeArgs := q.search.likeConditions("c.text")
+		conditions = append(conditions, likeConditions...)
+		args = append(args, likeArgs...)
+	}
+	if len(q.GroupID) != 0 {
+		conditions = append(conditions, "c.group_id = ?")
+		args = append(args, q.GroupID)
+	}
+	if q.Type != "" {
+		conditions = append(conditions, "c.type = ?")
+		args = append(args, q.Type)
+	}
+	if len(q.TopicID) != 0 {
+		conditions = append(conditions, "c.topic_id = ?")
+		args = append(args, q.TopicID)
+	}
+	if len(q.AuthorID) != 0 {
+		// the identity tag of the author is part of the entity id
+		conditions = append(conditions, "substr(c.entity_id, 10, 4) = ?")
+		args = append(args, q.AuthorID)
+	}
+	if q.Start != 0 {
+		conditions = append(conditions, "eav_ctime(c.entity_id) >= ?")
+		args = append(args, q.Start)
+	}
+	if q.End != 0 {
+		conditions = append(conditions, "eav_ctime(c.entity_id) <= ?")
+		args = append(args, q.End)
+	}
+	switch q.Completion {
+	case SearchCompletionIncomplete:
+		conditions = append(conditions, "c.type = 'todo' AND EXISTS (SELECT 1 FROM todos WHERE todos.group_id = c.group_id AND todos.id = c.entity_id AND todos.completed_at = 0)")
+	case SearchCompletionComplete:
+		conditions = append(conditions, "c.type = 'todo' AND EXISTS (SELECT 1 FROM todos WHERE todos.group_id = c.group_id AND todos.id = c.entity_id AND todos.completed_at != 0)")
+	}
+	return from, conditions, args
+}
+
+type rankedResult struct {
+	Result
+	Rank float64 `db:"rank"`
 }
 
-func (r *Roost) generateResultsGroup(groupID []byte, term, highlightStart, highlightEnd string, offset int) ([]*Result, error) {
-	results := make([]*Result, 0)
-	if err := r.slick.DB.Tx.Select(&results, `
+// Gets a page of results after the cursor, and the cursor for the next page if there is one.
+func (r *Roost) generateResultsGroup(q *SearchQuery, cursor *searchCursor) ([]*Result, *searchCursor, error) {
+	rankedResults := make([]*rankedResult, 0)
+	text := "c.text"
+	rank := "0"
+	order := "eav_ctime(c.entity_id) DESC, c.entity_id DESC"
+	args := make([]interface{}, 0)
+	index, match := q.ftsIndex()
+	ranked := index != "" && q.Order == SearchOrderRelevance
+	if index != "" {
+		text = "snippet(" + index + ", 0, ?, ?, '…', 15)"
+		args = append(args, q.HighlightStart, q.HighlightEnd)
+		if ranked {
+			rank = "bm25(" + index + ")"
+			order = rank + ", c.id"
+		}
+	}
+	from, conditions, conditionArgs := q.clauses(cursor)
+	args = append(args, conditionArgs...)
+	if cursor.RowID != 0 {
+		if ranked {
+			// scores change as entries are added, so compare with the current score of the last result where possible
+			cursorRank := "coalesce((SELECT " + rank + " FROM " + index + " WHERE " + index + ".text MATCH ? AND " + index + ".rowid = ?), ?)"
+			conditions = append(conditions, "("+rank+" > "+cursorRank+" OR ("+rank+" = "+cursorRank+" AND c.id > ?))")
+			args = append(args, match, cursor.RowID, cursor.Rank, match, cursor.RowID, cursor.Rank, cursor.RowID)
+		} else {
+			conditions = append(conditions, "(eav_ctime(c.entity_id) < eav_ctime(?) OR (eav_ctime(c.entity_id) = eav_ctime(?) AND c.entity_id < ?))")
+			args = append(args, cursor.EntityID, cursor.EntityID, cursor.EntityID)
+		}
+	}
+	// fetch one extra result to find out if there is another page
+	args = append(args, PageSize+1)
+	if err := r.slick.DB.Tx.Select(&rankedResults, `
 	SELECT
 		c.id as rowid,
-		snippet(fs_content_fts_idx, 0, ?, ?, '…', 15) as text,
+		`+text+` as text,
 		c.entity_id as entity_id,
 		c.group_id as group_id,
 		c.topic_id as topic_id,
 		t.label as topic_name,
-		c.type as type
-	FROM fs_content_fts_idx
-	LEFT JOIN fs_contents c ON c.rowid = fs_content_fts_idx.rowid
+		c.type as type,
+		`+rank+` as rank
+	FROM `+from+`
 	LEFT JOIN topics t ON t.group_id = c.group_id AND t.id = c.topic_id
-	WHERE c.group_id = ? AND fs_content_fts_idx.text MATCH ?
-	ORDER BY bm25(fs_content_fts_idx)
-	LIMIT ? OFFSET ?`, highlightStart, highlightEnd, groupID, term, PageSize, offset); err != nil {
-		return nil, err
+	WHERE `+strings.Join(conditions, " AND ")+`
+	ORDER BY `+order+`
+	LIMIT ?`, args...); err != nil {
+		return nil, nil, err
 	}
 
-	return results, nil
+	var nextCursor *searchCursor
+	if len(rankedResults) > PageSize {
+		rankedResults = rankedResults[:PageSize]
+		last := rankedResults[PageSize-1]
+		nextCursor = &searchCursor{cursor.MaxRowID, last.RowID, last.EntityID, last.Rank}
+	}
+	results := make([]*Result, len(rankedResults))
+	for i, rankedResult := range rankedResults {
+		results[i] = &rankedResult.Result
+	}
+	return results, nextCursor, nil
 }
 
-func (r *Roost) generateTotal(term string) (int, error) {
+func (r *Roost) generateTotal(q *SearchQuery, cursor *searchCursor) (int, error) {
 	var count int
-	if err := r.slick.DB.Tx.Get(&count, "select count(rowid) FROM fs_content_fts_idx WHERE text MATCH ?", term); err != nil {
+	from, conditions, args := q.clauses(cursor)
+	if err := r.slick.DB.Tx.Get(&count, "SELECT count(*) FROM "+from+" WHERE "+strings.Join(conditions, " AND "), args...); err != nil {
 		return 0, err
 	}
-	r.log.Debugf("generating count for %s total is %d", term, count)
+	r.log.Debugf("generating count for %s total is %d", q.Term, count)
 	return count, nil
 }
 
+// The entries which should be in fs_contents.
+const searchContentsSelect = `
+	SELECT group_id, topic_id, id AS entity_id, 'todo' AS type, body AS text FROM todos WHERE deleted = 0
+	UNION ALL SELECT group_id, topic_id, id, 'message', body FROM messages WHERE deleted = 0
+	UNION ALL SELECT group_id, id, id, 'topic', label FROM topics WHERE deleted = 0`
+
+// Compares the search index with the data it is built from, reporting any drift. This reads every todo, message
+// and topic, so it shouldn't be run routinely.
+func (r *Roost) VerifySearchIndex() (*SearchIndexReport, error) {
+	report := &SearchIndexReport{}
+	return report, r.slick.DB.Run("verify search index", func() error {
+		// text from the views may be stored as either text or blobs, so it is compared as text
+		if err := r.slick.DB.Tx.Get(report, `
+		WITH expected AS (`+searchContentsSelect+`)
+		SELECT
+			(SELECT count(*) FROM expected e WHERE NOT EXISTS (SELECT 1 FROM fs_contents c WHERE c.group_id = e.group_id AND c.entity_id = e.entity_id)) AS missing,
+			(SELECT count(*) FROM fs_contents c WHERE NOT EXISTS (SELECT 1 FROM expected e WHERE c.group_id = e.group_id AND c.entity_id = e.entity_id)) AS stale,
+			(SELECT count(*) FROM fs_contents c JOIN expected e ON c.group_id = e.group_id AND c.entity_id = e.entity_id WHERE CAST(c.text AS TEXT) != CAST(e.text AS TEXT) OR c.topic_id != e.topic_id OR c.type != e.type) AS mismatched`); err != nil {
+			return err
+		}
+
+		report.IndexesConsistent = true
+		for _, index := range []string{"fs_content_fts_idx", "fs_content_trigram_idx"} {
+			// comparing against the content table fails if the index doesn't agree with it
+			if _, err := r.slick.DB.Tx.Exec(fmt.Sprintf("INSERT INTO %s(%s, rank) VALUES('integrity-check', 1)", index, index)); err != nil {
+				r.log.Warnf("integrity check of %s failed %#v", index, err)
+				report.IndexesConsistent = false
+			}
+		}
+		return nil
+	})
+}
+
+// Rebuilds the search index, keeping the rows of entries already indexed so cursors stay valid.
+func (r *Roost) RebuildSearchIndex() error {
+	return r.slick.DB.Run("rebuild search index", func() error {
+		_, err := r.slick.DB.Tx.Exec(`
+		DELETE FROM fs_contents WHERE (group_id, entity_id) NOT IN (SELECT group_id, entity_id FROM (` + searchContentsSelect + `));
+		INSERT INTO fs_contents (group_id, topic_id, entity_id, type, text) SELECT * FROM (` + searchContentsSelect + `) WHERE true
+		ON CONFLICT(group_id, entity_id) DO UPDATE SET topic_id = excluded.topic_id, type = excluded.type, text = excluded.text
+		WHERE fs_contents.topic_id IS NOT excluded.topic_id OR fs_contents.type IS NOT excluded.type OR CAST(fs_contents.text AS TEXT) IS NOT excluded.text;
+		INSERT INTO fs_content_fts_idx(fs_content_fts_idx) VALUES('rebuild');
+		INSERT INTO fs_content_trigram_idx(fs_content_trigram_idx) VALUES('rebuild');
+		INSERT INTO fs_content_fts_idx(fs_content_fts_idx) VALUES('optimize');
+		INSERT INTO fs_content_trigram_idx(fs_content_trigram_idx) VALUES('optimize');`)
+		return err
+	})
+}
+
 // A group (or "roost") within Roost. This represents a set of identities
 // collaborating together in the same database.
 type RoostGroup struct { //nolint:revive
@@ -1057,6 +3298,56 @@ func makeRoostGroup(roost *Roost, groupIDSlice []byte) (*RoostGroup, error) {
 	return g, nil
 }
 
+// Gets the identity tags of the group's members which have shared a profile with it.
+func groupIdentityTags(s *slick.Slick, groupID ids.ID) ([][]byte, error) {
+	var identityTags [][]byte
+	if err := s.EAVSelect(&identityTags, "select distinct _identity_tag from profiles where group_id = ? order by _identity_tag", groupID[:]); err != nil {
+		return nil, err
+	}
+	return identityTags, nil
+}
+
+// Gets the members of the group along with the profiles they've shared with it. I'm listed first, followed by the
+// other members ordered by name.
+func (rg *RoostGroup) Members() (*Members, error) {
+	identityTags, err := groupIdentityTags(rg.roost.slick, rg.group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(identityTags, func(tag []byte) bool { return bytes.Equal(tag, rg.group.IdentityTag[:]) }) {
+		identityTags = append(identityTags, rg.group.IdentityTag[:])
+	}
+
+	var profiles []*Profile
+	if err := rg.roost.slick.EAVSelect(&profiles, "select * from profiles where group_id = ? order by _mtime, id", rg.group.ID[:]); err != nil {
+		return nil, err
+	}
+	// an identity writing its profile from several devices at once keeps the latest one
+	profilesByTag := make(map[string]*Profile, len(profiles))
+	for _, p := range profiles {
+		profilesByTag[string(p.IdentityID)] = p
+	}
+
+	members := make([]*Member, len(identityTags))
+	for i, tag := range identityTags {
+		members[i] = &Member{IdentityID: tag, Me: bytes.Equal(tag, rg.group.IdentityTag[:])}
+		if p, ok := profilesByTag[string(tag)]; ok {
+			members[i].Name = p.Name
+			members[i].Avatar = p.Avatar
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Me != members[j].Me {
+			return members[i].Me
+		}
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return bytes.Compare(members[i].IdentityID, members[j].IdentityID) < 0
+	})
+	return &Members{len(members), members}, nil
+}
+
 // CreateTopic creates a new topic with the given name.
 func (rg *RoostGroup) CreateTopic(label string) (*Topic, error) {
 	return rg.CreateTopicPinned(label, false)
@@ -1141,27 +3432,92 @@ func (rg *RoostGroup) MarkTopicRead(topicID []byte) error {
 	return writer.Execute()
 }
 
+// Selects topics along with their counts. The first parameter is the identity tag of the current user.
+const topicSelect = "select *, (select count(id) from messages where messages.group_id = topics.group_id AND messages.topic_id = topics.id and messages._identity_tag != ? and messages._ctime > topics.message_last_read and messages.deleted = 0) as unread_message_count, (select count(id) from todos where todos.group_id = topics.group_id AND topic_id = topics.id and todos.parent_id is null and todos.deleted = 0 and todos.completed_at = 0) as incomplete_todo_count, (select count(id) from todos where todos.group_id = topics.group_id AND  topic_id = topics.id and todos.parent_id is null and todos.deleted = 0 and todos.read = 0) as unread_todo_count from topics"
+
 // Gets a topic for a given id.
 func (rg *RoostGroup) Topic(id []byte) (*Topic, error) {
 	topic := Topic{}
-	if err := rg.roost.slick.EAVGet(&topic, "select *, (select count(id) from messages where messages.group_id = topics.group_id AND messages.topic_id = topics.id and messages._identity_tag != ? and messages._ctime > topics.message_last_read) as unread_message_count, (select count(id) from todos where todos.group_id = topics.group_id AND  topic_id = topics.id and todos.deleted = 0 and todos.completed_at = 0) as incomplete_todo_count, (select count(id) from todos where todos.group_id = topics.group_id AND  topic_id = topics.id and todos.deleted = 0 and todos.read = 0) as unread_todo_count from topics where group_id = ? AND id = ?", rg.group.IdentityTag[:], rg.group.ID[:], id[:]); err != nil {
+	if err := rg.roost.slick.EAVGet(&topic, topicSelect+" where group_id = ? AND id = ?", rg.group.IdentityTag[:], rg.group.ID[:], id[:]); err != nil {
 		return nil, err
 	}
 	return &topic, nil
 }
 
-// Gets a list of all topics.
+// Gets a list of all topics which haven't been archived or deleted.
 func (rg *RoostGroup) Topics() (*Topics, error) {
 	var unpinnedTopics, pinnedTopics []*Topic
-	if err := rg.roost.slick.EAVSelect(&pinnedTopics, "select *, (select count(id) from messages where messages.group_id = topics.group_id AND messages.topic_id = topics.id and messages._identity_tag != ? and messages._ctime > topics.message_last_read) as unread_message_count, (select count(id) from todos where todos.group_id = topics.group_id AND topic_id = topics.id and todos.deleted = 0 and todos.completed_at = 0) as incomplete_todo_count, (select count(id) from todos where todos.group_id = topics.group_id AND  topic_id = topics.id and todos.deleted = 0 and todos.read = 0) as unread_todo_count from topics WHERE group_id = ? AND pinned != 0 order by pin_position, _ctime", rg.group.IdentityTag[:], rg.group.ID[:]); err != nil {
+	if err := rg.roost.slick.EAVSelect(&pinnedTopics, topicSelect+" WHERE group_id = ? AND pinned != 0 AND archived = 0 AND deleted = 0 order by pin_position, _ctime", rg.group.IdentityTag[:], rg.group.ID[:]); err != nil {
 		return nil, err
 	}
-	if err := rg.roost.slick.EAVSelect(&unpinnedTopics, "select *, (select count(id) from messages where messages.group_id = topics.group_id AND messages.topic_id = topics.id and messages._identity_tag != ? and messages._ctime > topics.message_last_read) as unread_message_count, (select count(id) from todos where todos.group_id = topics.group_id AND topic_id = topics.id and todos.deleted = 0 and todos.completed_at = 0) as incomplete_todo_count, (select count(id) from todos where todos.group_id = topics.group_id AND  topic_id = topics.id and todos.deleted = 0 and todos.read = 0) as unread_todo_count from topics WHERE group_id = ? AND pinned = 0 order by position, _ctime", rg.group.IdentityTag[:], rg.group.ID[:]); err != nil {
+	if err := rg.roost.slick.EAVSelect(&unpinnedTopics, topicSelect+" WHERE group_id = ? AND pinned = 0 AND archived = 0 AND deleted = 0 order by position, _ctime", rg.group.IdentityTag[:], rg.group.ID[:]); err != nil {
 		return nil, err
 	}
 	return &Topics{len(pinnedTopics) + len(unpinnedTopics), pinnedTopics, unpinnedTopics}, nil
 }
 
+// Gets a list of all archived topics.
+func (rg *RoostGroup) ArchivedTopics() (*Topics, error) {
+	var archivedTopics []*Topic
+	if err := rg.roost.slick.EAVSelect(&archivedTopics, topicSelect+" WHERE group_id = ? AND archived != 0 AND deleted = 0 order by position, _ctime", rg.group.IdentityTag[:], rg.group.ID[:]); err != nil {
+		return nil, err
+	}
+	return &Topics{len(archivedTopics), nil, archivedTopics}, nil
+}
+
+// Archive a topic. Archived topics are not returned by Topics() but their contents can still be searched.
+func (rg *RoostGroup) ArchiveTopic(topicID []byte) error {
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("topics", topicID, map[string]interface{}{
+		"archived": true,
+	})
+	return writer.Execute()
+}
+
+// Unarchive a topic.
+func (rg *RoostGroup) UnarchiveTopic(topicID []byte) error {
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("topics", topicID, map[string]interface{}{
+		"archived": false,
+	})
+	return writer.Execute()
+}
+
+// Deletes a topic along with its todos and messages. Reactions to those todos and messages are deactivated.
+func (rg *RoostGroup) DeleteTopic(topicID []byte) error {
+	var todoIDs, messageIDs, reactionIDs [][]byte
+	if err := rg.roost.slick.EAVSelect(&todoIDs, "select id from todos where group_id = ? AND topic_id = ? AND deleted = 0", rg.group.ID[:], topicID); err != nil {
+		return err
+	}
+	if err := rg.roost.slick.EAVSelect(&messageIDs, "select id from messages where group_id = ? AND topic_id = ? AND deleted = 0", rg.group.ID[:], topicID); err != nil {
+		return err
+	}
+	if err := rg.roost.slick.EAVSelect(&reactionIDs, "select id from reactions where group_id = ? AND active = 1 AND (entity_id in (select id from todos where group_id = reactions.group_id AND topic_id = ?) OR entity_id in (select id from messages where group_id = reactions.group_id AND topic_id = ?))", rg.group.ID[:], topicID, topicID); err != nil {
+		return err
+	}
+
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("topics", topicID, map[string]interface{}{
+		"deleted": true,
+	})
+	for _, id := range todoIDs {
+		writer.Update("todos", id, map[string]interface{}{
+			"deleted": true,
+		})
+	}
+	for _, id := range messageIDs {
+		writer.Update("messages", id, map[string]interface{}{
+			"deleted": true,
+		})
+	}
+	for _, id := range reactionIDs {
+		writer.Update("reactions", id, map[string]interface{}{
+			"active": false,
+		})
+	}
+	return writer.Execute()
+}
+
 // Pin a topic
 func (rg *RoostGroup) PinTopic(topicID []byte, pinned bool) error {
 	writer := rg.roost.slick.EAVWriter(rg.group)
@@ -1250,7 +3606,7 @@ func (rg *RoostGroup) CreateTodo(topicID []byte, label string) (*Todo, error) {
 	maxPositionRow := struct {
 		MaxPosition *float64 `db:"max_position"`
 	}{}
-	if err := rg.roost.slick.EAVGet(&maxPositionRow, "select max(position) as max_position from todos where group_id = ? AND topic_id = ? AND deleted = 0 AND completed_at = 0", rg.group.ID[:], topicID); err != nil {
+	if err := rg.roost.slick.EAVGet(&maxPositionRow, "select max(position) as max_position from todos where group_id = ? AND topic_id = ? AND parent_id IS NULL AND deleted = 0 AND completed_at = 0", rg.group.ID[:], topicID); err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
 			return nil, err
 		}
@@ -1272,6 +3628,42 @@ func (rg *RoostGroup) CreateTodo(topicID []byte, label string) (*Todo, error) {
 	return rg.Todo(writer.InsertIDs[0][:])
 }
 
+// Creates a subtodo of the given parent todo with a textual body. Subtodos belong to the same topic as their parent.
+func (rg *RoostGroup) CreateSubtodo(parentID []byte, body string) (*Todo, error) {
+	parent, err := rg.Todo(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.ParentID != nil {
+		return nil, errors.New("cannot create a subtodo of a subtodo")
+	}
+	maxPosition := float64(0)
+	maxPositionRow := struct {
+		MaxPosition *float64 `db:"max_position"`
+	}{}
+	if err := rg.roost.slick.EAVGet(&maxPositionRow, "select max(position) as max_position from todos where group_id = ? AND parent_id = ? AND deleted = 0 AND completed_at = 0", rg.group.ID[:], parentID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	} else if maxPositionRow.MaxPosition != nil {
+		maxPosition = randomPosition(*maxPositionRow.MaxPosition, *maxPositionRow.MaxPosition+2)
+	}
+
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Insert("todos", map[string]interface{}{
+		"body":      body,
+		"topic_id":  parent.TopicID,
+		"parent_id": parentID,
+		"position":  maxPosition,
+		"read":      true,
+	})
+	if err := writer.Execute(); err != nil {
+		return nil, err
+	}
+
+	return rg.Todo(writer.InsertIDs[0][:])
+}
+
 // Create a todo updater which can be used for marking todos complete en masse
 func (rg *RoostGroup) TodoUpdater() *TodoUpdater {
 	return &TodoUpdater{rg, make(map[ids.ID]bool), make(map[ids.ID]bool)}
@@ -1279,13 +3671,26 @@ func (rg *RoostGroup) TodoUpdater() *TodoUpdater {
 
 // Moves a todo item in the given topic specified by id
 func (rg *RoostGroup) MoveTodo(complete bool, topicID []byte, from, to int) error {
-	var targetTodos []*Todo
-	var pos func(*Todo) float64
-	var posProp string
 	todos, err := rg.Todos(topicID)
 	if err != nil {
 		return err
 	}
+	return rg.moveTodo(todos, complete, from, to)
+}
+
+// Moves a subtodo within the subtodos of the given parent todo.
+func (rg *RoostGroup) MoveSubtodo(complete bool, parentID []byte, from, to int) error {
+	todos, err := rg.Subtodos(parentID)
+	if err != nil {
+		return err
+	}
+	return rg.moveTodo(todos, complete, from, to)
+}
+
+func (rg *RoostGroup) moveTodo(todos *Todos, complete bool, from, to int) error {
+	var targetTodos []*Todo
+	var pos func(*Todo) float64
+	var posProp string
 
 	if complete {
 		targetTodos = todos.completeTodos
@@ -1321,20 +3726,31 @@ func (rg *RoostGroup) MoveTodo(complete bool, topicID []byte, from, to int) erro
 	return writer.Execute()
 }
 
+const todoSelect = "select *, (select count(id) from todos subtodos where subtodos.group_id = todos.group_id AND subtodos.parent_id = todos.id and subtodos.deleted = 0) as subtodo_count, (select count(id) from todos subtodos where subtodos.group_id = todos.group_id AND subtodos.parent_id = todos.id and subtodos.deleted = 0 and subtodos.completed_at != 0) as completed_subtodo_count from todos"
+
 // Gets a todo for a given id.
 func (rg *RoostGroup) Todo(id []byte) (*Todo, error) {
 	todo := Todo{}
-	return &todo, rg.roost.slick.EAVGet(&todo, "select * from todos where group_id = ? AND id = ?", rg.group.ID[:], id[:])
+	return &todo, rg.roost.slick.EAVGet(&todo, todoSelect+" where group_id = ? AND id = ?", rg.group.ID[:], id[:])
 }
 
-// Gets a list of todos for a given topic id.
+// Gets a list of todos for a given topic id. Subtodos are not included.
 func (rg *RoostGroup) Todos(topicID []byte) (*Todos, error) {
+	return rg.selectTodos("topic_id = ? AND parent_id IS NULL", topicID)
+}
+
+// Gets a list of subtodos for a given parent todo id.
+func (rg *RoostGroup) Subtodos(parentID []byte) (*Todos, error) {
+	return rg.selectTodos("parent_id = ?", parentID)
+}
+
+func (rg *RoostGroup) selectTodos(where string, arg []byte) (*Todos, error) {
 	var incompleteTodos []*Todo
-	if err := rg.roost.slick.EAVSelect(&incompleteTodos, "select * from todos where group_id = ? AND topic_id = ? AND deleted = 0 AND completed_at = 0 order by position, id", rg.group.ID[:], topicID[:]); err != nil {
+	if err := rg.roost.slick.EAVSelect(&incompleteTodos, todoSelect+" where group_id = ? AND "+where+" AND deleted = 0 AND completed_at = 0 order by position, id", rg.group.ID[:], arg); err != nil {
 		return nil, err
 	}
 	var completeTodos []*Todo
-	if err := rg.roost.slick.EAVSelect(&completeTodos, "select * from todos where group_id = ? AND topic_id = ? AND deleted = 0 AND completed_at != 0 order by completed_position, id", rg.group.ID[:], topicID[:]); err != nil {
+	if err := rg.roost.slick.EAVSelect(&completeTodos, todoSelect+" where group_id = ? AND "+where+" AND deleted = 0 AND completed_at != 0 order by completed_position, id", rg.group.ID[:], arg); err != nil {
 		return nil, err
 	}
 
@@ -1394,13 +3810,94 @@ func (rg *RoostGroup) Reactions(entityID []byte) (*Reactions, error) {
 	return &Reactions{len(reactions), reactions}, nil
 }
 
+// Gets a summary of the reactions to an entity.
+func (rg *RoostGroup) ReactionSummary(entityID []byte) (*ReactionSummary, error) {
+	entityIDs := NewIDList()
+	entityIDs.Add(entityID)
+	summaries, err := rg.ReactionSummaries(entityIDs)
+	if err != nil {
+		return nil, err
+	}
+	return summaries.Summary(0), nil
+}
+
+// Gets summaries of the reactions to several entities at once, such as a page of messages. Summaries are returned
+// in the same order as the ids, including empty summaries for entities without reactions.
+func (rg *RoostGroup) ReactionSummaries(entityIDs *IDList) (*ReactionSummaries, error) {
+	summaries := make([]*ReactionSummary, entityIDs.Count)
+	summariesByID := make(map[string]*ReactionSummary, entityIDs.Count)
+	args := make([]interface{}, 0, entityIDs.Count+1)
+	args = append(args, rg.group.ID[:])
+	for i, entityID := range entityIDs.ids {
+		// an id listed more than once shares the same summary
+		if summary, ok := summariesByID[string(entityID)]; ok {
+			summaries[i] = summary
+			continue
+		}
+		summaries[i] = &ReactionSummary{EntityID: entityID, runes: []*RuneReaction{}}
+		summariesByID[string(entityID)] = summaries[i]
+		args = append(args, entityID)
+	}
+	if entityIDs.Count == 0 {
+		return &ReactionSummaries{0, summaries}, nil
+	}
+
+	var reactions []*Reaction
+	if err := rg.roost.slick.EAVSelect(&reactions, "select * from reactions where group_id = ? AND entity_id IN (?"+strings.Repeat(", ?", len(args)-2)+") AND active = 1 ORDER BY _ctime, id", args...); err != nil {
+		return nil, err
+	}
+	for _, reaction := range reactions {
+		summary := summariesByID[string(reaction.EntityID)]
+		var runeReaction *RuneReaction
+		for _, rr := range summary.runes {
+			if rr.Rune == reaction.Rune {
+				runeReaction = rr
+				break
+			}
+		}
+		if runeReaction == nil {
+			runeReaction = &RuneReaction{Rune: reaction.Rune}
+			summary.runes = append(summary.runes, runeReaction)
+			summary.Count = len(summary.runes)
+		}
+		// an identity reacting from several devices at once is only counted once
+		if slices.IndexFunc(runeReaction.identityIDs, func(id []byte) bool { return bytes.Equal(id, reaction.IdentityID) }) != -1 {
+			continue
+		}
+		runeReaction.identityIDs = append(runeReaction.identityIDs, reaction.IdentityID)
+		runeReaction.Count = len(runeReaction.identityIDs)
+		runeReaction.Mine = runeReaction.Mine || bytes.Equal(reaction.IdentityID, rg.group.IdentityTag[:])
+	}
+	return &ReactionSummaries{len(summaries), summaries}, nil
+}
+
 // Creates a message in a given topic id with a textual body.
 func (rg *RoostGroup) CreateMessage(topicID []byte, body string) (*Message, error) {
-	writer := rg.roost.slick.EAVWriter(rg.group)
-	writer.Insert("messages", map[string]interface{}{
+	return rg.createMessage(topicID, body, nil)
+}
+
+// Creates a message in a given topic id which replies to another message or todo specified by parentID.
+func (rg *RoostGroup) CreateReply(topicID, parentID []byte, body string) (*Message, error) {
+	var parentCount int
+	if err := rg.roost.slick.EAVGet(&parentCount, "select (select count(*) from messages where group_id = ? AND id = ?) + (select count(*) from todos where group_id = ? AND id = ?)", rg.group.ID[:], parentID, rg.group.ID[:], parentID); err != nil {
+		return nil, err
+	}
+	if parentCount == 0 {
+		return nil, fmt.Errorf("no message or todo found for id %x", parentID)
+	}
+	return rg.createMessage(topicID, body, parentID)
+}
+
+func (rg *RoostGroup) createMessage(topicID []byte, body string, replyTo []byte) (*Message, error) {
+	values := map[string]interface{}{
 		"body":     body,
 		"topic_id": topicID,
-	})
+	}
+	if replyTo != nil {
+		values["reply_to"] = replyTo
+	}
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Insert("messages", values)
 	writer.Update("topics", topicID, map[string]interface{}{
 		"message_last_read": now(),
 	})
@@ -1411,10 +3908,13 @@ func (rg *RoostGroup) CreateMessage(topicID []byte, body string) (*Message, erro
 	return rg.Message(writer.InsertIDs[0][:])
 }
 
+// Selects messages including deleted ones, whose blanked bodies are read back as NULL.
+const messageSelect = "select group_id, id, _identity_tag, _membership_tag, _ctime, _mtime, _wtime, topic_id, coalesce(body, '') as body, deleted, reply_to from messages"
+
 // Gets a message for a given id.
 func (rg *RoostGroup) Message(id []byte) (*Message, error) {
 	message := Message{}
-	return &message, rg.roost.slick.EAVGet(&message, "select * from messages where group_id = ? AND id = ?", rg.group.ID[:], id[:])
+	return &message, rg.roost.slick.EAVGet(&message, messageSelect+" where group_id = ? AND id = ?", rg.group.ID[:], id[:])
 }
 
 // Gets a list of messages for a given topic id and a cursor. If cursor is "", it retrieves messages in reverse chronological order.
@@ -1422,22 +3922,86 @@ func (rg *RoostGroup) Message(id []byte) (*Message, error) {
 func (rg *RoostGroup) Messages(topicID []byte, cursor string) (*PagedMessages, error) {
 	pagedMessages := PagedMessages{}
 	if cursor == "" {
-		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND topic_id = ? order by _ctime desc, id limit ?", rg.group.ID[:], topicID[:], MessagesPageSize); err != nil {
+		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND topic_id = ? AND deleted = 0 order by _ctime desc, id desc limit ?", rg.group.ID[:], topicID[:], MessagesPageSize); err != nil {
+			return nil, err
+		}
+	} else {
+		cursorID, err := parseMessageCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND topic_id = ? AND deleted = 0 AND "+olderThanCursor+" order by _ctime desc, id desc limit ?", rg.group.ID[:], topicID[:], cursorID, cursorID, cursorID, MessagesPageSize); err != nil {
+			return nil, err
+		}
+		pagedMessages.NewerCursor = cursor
+	}
+	pagedMessages.AtEnd = len(pagedMessages.values) != MessagesPageSize
+	pagedMessages.AtNewest = cursor == ""
+	pagedMessages.setCursors()
+	return &pagedMessages, nil
+}
+
+// Gets the messages in a topic newer than a cursor, ordered newest first like Messages. Use the NewerCursor value
+// provided by PagedMessages.
+func (rg *RoostGroup) MessagesAfter(topicID []byte, cursor string) (*PagedMessages, error) {
+	cursorID, err := parseMessageCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	pagedMessages := PagedMessages{Cursor: cursor, NewerCursor: cursor}
+	if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from (select * from messages where group_id = ? AND topic_id = ? AND deleted = 0 AND "+newerThanCursor+" order by _ctime, id limit ?) order by _ctime desc, id desc", rg.group.ID[:], topicID[:], cursorID, cursorID, cursorID, MessagesPageSize); err != nil {
+		return nil, err
+	}
+	pagedMessages.AtNewest = len(pagedMessages.values) != MessagesPageSize
+	pagedMessages.setCursors()
+	return &pagedMessages, nil
+}
+
+// Gets a page of messages in a topic centered on the given message, ordered newest first like Messages. This is used
+// to open a topic at a message found by searching or linked to by a reply, and to page in both directions from it.
+func (rg *RoostGroup) MessagesAround(topicID, messageID []byte) (*PagedMessages, error) {
+	var message Message
+	if err := rg.roost.slick.EAVGet(&message, "select * from messages where group_id = ? AND topic_id = ? AND id = ? AND deleted = 0", rg.group.ID[:], topicID, messageID); err != nil {
+		return nil, err
+	}
+
+	pagedMessages := PagedMessages{}
+	older := make([]*Message, 0)
+	// the older half includes the message itself
+	if err := rg.roost.slick.EAVSelect(&older, "select * from messages where group_id = ? AND topic_id = ? AND deleted = 0 AND (id = ? OR "+olderThanCursor+") order by _ctime desc, id desc limit ?", rg.group.ID[:], topicID, message.ID, message.ID, message.ID, message.ID, MessagesPageSize/2); err != nil {
+		return nil, err
+	}
+	if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from (select * from messages where group_id = ? AND topic_id = ? AND deleted = 0 AND "+newerThanCursor+" order by _ctime, id limit ?) order by _ctime desc, id desc", rg.group.ID[:], topicID, message.ID, message.ID, message.ID, MessagesPageSize/2); err != nil {
+		return nil, err
+	}
+	pagedMessages.AtEnd = len(older) != MessagesPageSize/2
+	pagedMessages.AtNewest = len(pagedMessages.values) != MessagesPageSize/2
+	pagedMessages.values = append(pagedMessages.values, older...)
+	pagedMessages.setCursors()
+	return &pagedMessages, nil
+}
+
+// Gets the replies to a given message or todo id in chronological order. If cursor is "", it retrieves the first page
+// of replies. Otherwise, use the cursor value provided by PagedMessages.
+func (rg *RoostGroup) Thread(parentID []byte, cursor string) (*PagedMessages, error) {
+	pagedMessages := PagedMessages{}
+	if cursor == "" {
+		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND reply_to = ? AND deleted = 0 order by _ctime, id limit ?", rg.group.ID[:], parentID, MessagesPageSize); err != nil {
 			return nil, err
 		}
 	} else {
-		cursorFloat, err := strconv.ParseFloat(cursor, 64)
+		cursorID, err := parseMessageCursor(cursor)
 		if err != nil {
 			return nil, err
 		}
-		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND topic_id = ? AND _ctime < ? order by _ctime desc, id limit ?", rg.group.ID[:], topicID[:], cursorFloat, MessagesPageSize); err != nil {
+		if err := rg.roost.slick.EAVSelect(&pagedMessages.values, "select * from messages where group_id = ? AND reply_to = ? AND deleted = 0 AND "+newerThanCursor+" order by _ctime, id limit ?", rg.group.ID[:], parentID, cursorID, cursorID, cursorID, MessagesPageSize); err != nil {
 			return nil, err
 		}
 	}
 	pagedMessages.Count = len(pagedMessages.values)
 	pagedMessages.AtEnd = len(pagedMessages.values) != MessagesPageSize
 	if len(pagedMessages.values) != 0 {
-		pagedMessages.Cursor = strconv.FormatFloat(pagedMessages.values[len(pagedMessages.values)-1].CtimeSec, 'f', -1, 64)
+		pagedMessages.Cursor = messageCursor(pagedMessages.values[len(pagedMessages.values)-1].ID)
 	}
 	return &pagedMessages, nil
 }
@@ -1452,12 +4016,176 @@ func (rg *RoostGroup) UpdateMessage(message *Message) error {
 	return writer.Execute()
 }
 
-// Gets a list of all connected devices to the current identity.
+// Deletes a message for all members of the group. The body of the message is blanked so it's no longer stored or
+// synced, and reactions to the message are deactivated.
+func (rg *RoostGroup) DeleteMessage(id []byte) error {
+	var reactionIDs [][]byte
+	if err := rg.roost.slick.EAVSelect(&reactionIDs, "select id from reactions where group_id = ? AND entity_id = ? AND active = 1", rg.group.ID[:], id); err != nil {
+		return err
+	}
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("messages", id, map[string]interface{}{
+		"body":    "",
+		"deleted": true,
+	})
+	for _, reactionID := range reactionIDs {
+		writer.Update("reactions", reactionID, map[string]interface{}{
+			"active": false,
+		})
+	}
+	return writer.Execute()
+}
+
+// Sets when a todo is due and when to be reminded about it, in seconds since the Unix epoch. A value of 0 clears
+// either. The due date is shared with the group while the reminder only applies to your own devices.
+func (rg *RoostGroup) SetTodoDue(todoID []byte, dueAt, remindAt float64) error {
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("todos", todoID, map[string]interface{}{
+		"due_at":    dueAt,
+		"remind_at": remindAt,
+	})
+	return writer.Execute()
+}
+
+// Assigns a todo to the group member with the given identity tag. A nil identity tag unassigns the todo.
+func (rg *RoostGroup) AssignTodo(todoID, identityTag []byte) error {
+	var assignee interface{}
+	if len(identityTag) != 0 {
+		if len(identityTag) != len(rg.group.IdentityTag) {
+			return fmt.Errorf("expected identity tag of length %d, got %d", len(rg.group.IdentityTag), len(identityTag))
+		}
+		assignee = identityTag
+	}
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("todos", todoID, map[string]interface{}{
+		"assignee": assignee,
+	})
+	return writer.Execute()
+}
+
+// Sets the recurrence rule for a todo. Rules are a subset of RFC 5545 RRULEs, for example "FREQ=DAILY",
+// "FREQ=WEEKLY;BYDAY=MO,TH" or "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=-1;UNTIL=20301231". An empty rule stops the todo
+// from recurring.
+func (rg *RoostGroup) SetTodoRecurrence(todoID []byte, rule string) error {
+	if rule != "" {
+		if _, err := parseRecurrence(rule); err != nil {
+			return err
+		}
+	}
+	writer := rg.roost.slick.EAVWriter(rg.group)
+	writer.Update("todos", todoID, map[string]interface{}{
+		"recurrence": rule,
+	})
+	return writer.Execute()
+}
+
+// Adds the next occurrence of a recurring todo which is about to be completed to the writer. The next occurrence
+// is due at the first recurrence after the todo's due date, or after completedAt if it has no due date. Nothing is
+// added if the next occurrence already exists.
+func (rg *RoostGroup) writeNextOccurrence(writer *slick.EAVWriter, todoID []byte, completedAt float64) error {
+	todo, err := rg.Todo(todoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if todo.Recurrence == "" || todo.Deleted || todo.CompletedAt != 0 {
+		return nil
+	}
+	rc, err := parseRecurrence(todo.Recurrence)
+	if err != nil {
+		return err
+	}
+	base := todo.DueAt
+	if base == 0 {
+		base = completedAt
+	}
+	next, ok := rc.next(time.UnixMicro(int64(base * 1000000)))
+	if !ok {
+		return nil
+	}
+	recurrenceOf := todo.RecurrenceOf
+	if recurrenceOf == nil {
+		recurrenceOf = todo.ID
+	}
+	var existing int
+	if err := rg.roost.slick.EAVGet(&existing, "select count(*) from todos where group_id = ? AND recurrence_of = ? AND sequence = ?", rg.group.ID[:], recurrenceOf, todo.Sequence+1); err != nil {
+		return err
+	}
+	if existing != 0 {
+		return nil
+	}
+
+	nextDueAt := float64(next.UnixMicro()) / 1000000
+	remindAt := float64(0)
+	if todo.RemindAt != 0 && todo.DueAt != 0 {
+		remindAt = todo.RemindAt + nextDueAt - todo.DueAt
+	}
+	values := map[string]interface{}{
+		"body":          todo.Body,
+		"topic_id":      todo.TopicID,
+		"position":      todo.Position,
+		"read":          true,
+		"due_at":        nextDueAt,
+		"remind_at":     remindAt,
+		"recurrence":    todo.Recurrence,
+		"recurrence_of": recurrenceOf,
+		"sequence":      todo.Sequence + 1,
+	}
+	if todo.AssigneeID != nil {
+		values["assignee"] = todo.AssigneeID
+	}
+	writer.Insert("todos", values)
+	return nil
+}
+
+// Deletes all but the first, by id, of the occurrences of a recurring todo which share the sequence of the given todo.
+// Duplicates are created when members complete the same occurrence concurrently while offline, and every member
+// resolves them the same way.
+func (r *Roost) removeDuplicateOccurrences(s *slick.Slick, groupID, id ids.ID) error {
+	todo := Todo{}
+	if err := s.EAVGet(&todo, "select * from todos where group_id = ? AND id = ?", groupID[:], id[:]); err != nil {
+		return err
+	}
+	if todo.RecurrenceOf == nil || todo.Deleted {
+		return nil
+	}
+	var occurrenceIDs [][]byte
+	if err := s.EAVSelect(&occurrenceIDs, "select id from todos where group_id = ? AND recurrence_of = ? AND sequence = ? AND deleted = 0 order by id", groupID[:], todo.RecurrenceOf, todo.Sequence); err != nil {
+		return err
+	}
+	if len(occurrenceIDs) < 2 {
+		return nil
+	}
+	group, err := s.Group(groupID)
+	if err != nil {
+		return err
+	}
+	writer := s.EAVWriter(group)
+	for _, duplicateID := range occurrenceIDs[1:] {
+		writer.Update("todos", duplicateID, map[string]interface{}{
+			"deleted": true,
+		})
+	}
+	return writer.Execute()
+}
+
+// Deletes a todo along with its subtodos.
 func (rg *RoostGroup) DeleteTodo(id []byte) error {
+	var subtodoIDs [][]byte
+	if err := rg.roost.slick.EAVSelect(&subtodoIDs, "select id from todos where group_id = ? AND parent_id = ? AND deleted = 0", rg.group.ID[:], id); err != nil {
+		return err
+	}
 	writer := rg.roost.slick.EAVWriter(rg.group)
 	writer.Update("todos", id, map[string]interface{}{
 		"deleted": true,
 	})
+	for _, subtodoID := range subtodoIDs {
+		writer.Update("todos", subtodoID, map[string]interface{}{
+			"deleted": true,
+		})
+	}
 	return writer.Execute()
 }
 
@@ -1,12 +1,18 @@
 package roost
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/meow-io/go-slick"
+	"github.com/meow-io/go-slick/ids"
+	"github.com/meow-io/go-slick/messaging"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,6 +34,7 @@ func makeRoost(root string) (*Roost, []interface{}, error) {
 
 	go func() {
 		updates := roost.Updates()
+		defer updates.Close()
 		for {
 			updates.Next()
 			events = append(events, updates.item)
@@ -103,6 +110,288 @@ func TestRoostShutdown(t *testing.T) {
 	}
 }
 
+func TestRoostSubscribe(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	all1 := roost1.Updates()
+	all2 := roost1.Updates()
+	filter := &UpdateFilter{ViewName: "todos"}
+	filter.AddType(UpdateEntityUpdate)
+	todoUpdates := roost1.Subscribe(filter)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "need to mow the lawn")
+	require.Nil(err)
+	message, err := group.CreateMessage(topics.Topic(0).ID, "the lawn looks great")
+	require.Nil(err)
+
+	for {
+		todoUpdates.Next()
+		require.Equal(UpdateEntityUpdate, todoUpdates.Type())
+		require.Equal("todos", todoUpdates.ViewEntityUpdate().ViewName)
+		if bytes.Equal(todo.ID, todoUpdates.ViewEntityUpdate().EntityID) {
+			break
+		}
+	}
+	todoUpdates.Close()
+	todoUpdates.Next()
+	require.Equal(UpdateFinished, todoUpdates.Type())
+
+	// every subscription gets its own copy of each update
+	for _, u := range []*Updates{all1, all2} {
+		for {
+			u.Next()
+			if u.Type() == UpdateEntityUpdate && bytes.Equal(message.ID, u.ViewEntityUpdate().EntityID) {
+				break
+			}
+		}
+		u.Close()
+	}
+
+	groupFilter := &UpdateFilter{GroupID: group.GroupID}
+	groupUpdates := roost1.Subscribe(groupFilter)
+	defer groupUpdates.Close()
+	_, err = group.CreateTodo(topics.Topic(0).ID, "water the lawn")
+	require.Nil(err)
+	groupUpdates.Next()
+	require.Equal(group.GroupID, updateGroupID(groupUpdates.item))
+}
+
+func TestRoostEntityUpdateKinds(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	filter := &UpdateFilter{ViewName: "todos"}
+	filter.AddType(UpdateEntityUpdate)
+	u := roost1.Subscribe(filter)
+	defer u.Close()
+	nextUpdate := func(id []byte) *EntityUpdate {
+		for {
+			u.Next()
+			if bytes.Equal(id, u.ViewEntityUpdate().EntityID) {
+				return u.ViewEntityUpdate()
+			}
+		}
+	}
+
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
+	require.Nil(err)
+	update := nextUpdate(todo.ID)
+	require.Equal("todos", update.ViewName)
+	require.Equal(EntityInserted, update.Kind)
+
+	todo.Body = "mow the lawn today"
+	require.Nil(group.UpdateTodo(todo))
+	update = nextUpdate(todo.ID)
+	require.Equal(EntityUpdated, update.Kind)
+	require.Equal(1, update.ChangedColumnCount)
+	require.Equal("body", update.ChangedColumn(0))
+
+	// todos created by me start out read
+	updater := group.TodoUpdater()
+	updater.MarkRead(todo.ID, false)
+	require.Nil(updater.Commit())
+	update = nextUpdate(todo.ID)
+	require.Equal(EntityUpdated, update.Kind)
+	require.Equal(1, update.ChangedColumnCount)
+	require.Equal("read", update.ChangedColumn(0))
+
+	require.Nil(group.DeleteTodo(todo.ID))
+	update = nextUpdate(todo.ID)
+	require.Equal(EntityDeleted, update.Kind)
+	require.Equal(0, update.ChangedColumnCount)
+}
+
+func TestRoostEntityUpdateOrder(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	filter := &UpdateFilter{ViewName: "todos"}
+	filter.AddType(UpdateEntityUpdate)
+	u := roost1.Subscribe(filter)
+	defer u.Close()
+
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
+	require.Nil(err)
+	for i := 0; i < 20; i++ {
+		todo.Body = fmt.Sprintf("mow the lawn %d", i)
+		require.Nil(group.UpdateTodo(todo))
+	}
+	require.Nil(group.DeleteTodo(todo.ID))
+
+	kinds := make([]int, 0)
+	for len(kinds) == 0 || kinds[len(kinds)-1] != EntityDeleted {
+		u.Next()
+		if bytes.Equal(todo.ID, u.ViewEntityUpdate().EntityID) {
+			kinds = append(kinds, u.ViewEntityUpdate().Kind)
+		}
+	}
+	require.Len(kinds, 22)
+	require.Equal(EntityInserted, kinds[0])
+	for _, kind := range kinds[1:21] {
+		require.Equal(EntityUpdated, kind)
+	}
+}
+
+func TestRoostReactionUpdates(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	message, err := group.CreateMessage(topics.Topic(0).ID, "the lawn looks great")
+	require.Nil(err)
+	u := roost1.Subscribe(&UpdateFilter{ViewName: "reactions"})
+	defer u.Close()
+	nextEntityUpdate := func() *EntityUpdate {
+		for {
+			u.Next()
+			if u.Type() == UpdateEntityUpdate {
+				return u.ViewEntityUpdate()
+			}
+		}
+	}
+
+	require.Nil(group.SetReaction(message.ID, "👍", true))
+	update := nextEntityUpdate()
+	require.Equal(EntityInserted, update.Kind)
+	require.Equal(message.ID, update.TargetID)
+
+	require.Nil(group.SetReaction(message.ID, "👍", false))
+	update = nextEntityUpdate()
+	require.Equal(EntityDeleted, update.Kind)
+	require.Equal(message.ID, update.TargetID)
+}
+
+func TestRoostRolledBackUpdates(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	filter := &UpdateFilter{}
+	filter.AddType(UpdateViewUpdate)
+	u := roost1.Subscribe(filter)
+	defer u.Close()
+
+	require.NotNil(roost1.slick.DB.Run("rolled back", func() error {
+		roost1.stageUpdate(&ViewUpdate{"reactions"})
+		return errors.New("rolled back")
+	}))
+	require.Nil(roost1.slick.DB.Run("committed", func() error {
+		roost1.stageUpdate(&ViewUpdate{"todos"})
+		_, err := roost1.slick.DB.Tx.Exec("UPDATE reminder_checks SET checked_at = checked_at")
+		return err
+	}))
+	u.Next()
+	require.Equal(UpdateViewUpdate, u.Type())
+	require.Equal("todos", u.ViewUpdate().viewName)
+}
+
+func TestRoostUpdatesOverflow(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+
+	// duplicate view updates waiting to be read are coalesced
+	views := roost1.Subscribe(&UpdateFilter{GroupID: []byte("none")})
+	views.enqueue(&ViewUpdate{"messages"})
+	views.enqueue(&ViewUpdate{"todos"})
+	views.enqueue(&ViewUpdate{"messages"})
+	require.Equal(2, len(views.queue))
+	views.Next()
+	views.enqueue(&ViewUpdate{"messages"})
+	require.Equal(2, len(views.queue))
+	views.Close()
+
+	// group and transport state updates waiting to be read are replaced by later ones
+	states := roost1.Subscribe(&UpdateFilter{GroupID: []byte("none")})
+	groupID := ids.IDFromBytes(group.GroupID)
+	states.enqueue(&slick.GroupUpdate{ID: groupID, GroupState: messaging.GroupStateSynced, Seq: 1})
+	states.enqueue(&slick.TransportStateUpdate{URL: "heya://a", State: "connecting"})
+	states.enqueue(&slick.GroupUpdate{ID: groupID, GroupState: messaging.GroupStateSynced, Seq: 2})
+	states.enqueue(&slick.TransportStateUpdate{URL: "heya://a", State: "connected"})
+	states.enqueue(&slick.GroupUpdate{ID: groupID, GroupState: slick.IntroSucceeded})
+	require.Equal(3, len(states.queue))
+	require.Equal(uint64(2), states.queue[0].(*slick.GroupUpdate).Seq)
+	require.Equal("connected", states.queue[1].(*slick.TransportStateUpdate).State)
+
+	// a subscription which is never read holds a limited number of updates
+	for i := 0; i != queuedUpdatesLimit+10; i++ {
+		states.enqueue(&ReminderUpdate{})
+	}
+	require.Equal(queuedUpdatesLimit, len(states.queue))
+	states.Close()
+
+	// a subscription which isn't read doesn't block writes, and entity updates are dropped once it falls behind
+	u := roost1.Updates()
+	defer u.Close()
+	for i := 0; i != maxQueuedUpdates+50; i++ {
+		_, err := group.CreateMessage(topics.Topic(0).ID, fmt.Sprintf("hello %d", i))
+		require.Nil(err)
+	}
+	entityUpdates := 0
+	for {
+		u.Next()
+		if u.Type() == UpdateResyncRequired {
+			break
+		}
+		if u.Type() == UpdateEntityUpdate {
+			entityUpdates++
+		}
+	}
+	require.Less(entityUpdates, maxQueuedUpdates)
+
+	// read past the updates queued behind the resync
+	for {
+		u.lock.Lock()
+		queued := len(u.queue)
+		u.lock.Unlock()
+		if queued == 0 {
+			break
+		}
+		u.Next()
+	}
+
+	// once the resync has been read, entity updates are delivered again
+	message, err := group.CreateMessage(topics.Topic(0).ID, "caught up")
+	require.Nil(err)
+	for {
+		u.Next()
+		require.NotEqual(UpdateResyncRequired, u.Type())
+		if u.Type() == UpdateEntityUpdate && bytes.Equal(message.ID, u.ViewEntityUpdate().EntityID) {
+			break
+		}
+	}
+}
+
 func TestRoostCreateTodo(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
@@ -217,7 +506,7 @@ func TestRoostDeleteTodo(t *testing.T) {
 	require.Equal(0, topics.Topic(0).IncompleteTodoCount)
 }
 
-func TestRoostMoveTodoInList(t *testing.T) {
+func TestRoostRestoreDeletedTodo(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -227,49 +516,75 @@ func TestRoostMoveTodoInList(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
-	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "need to mow the lawn")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
+	todo.Body = "need to mow the lawn today"
+	require.Nil(group.UpdateTodo(todo))
+	require.Nil(group.DeleteTodo(todo.ID))
+	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
+	require.Equal(0, result.Count)
+
+	todo, err = group.Todo(todo.ID)
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
+	todo.Deleted = false
+	require.Nil(group.UpdateTodo(todo))
+	result, err = roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 2))
-	todos, err := group.Todos(topics.Topic(0).ID)
+	require.Equal(1, result.Count)
+	require.Equal(todo.ID, result.Result(0).EntityID)
+	status, err := roost1.VerifySearchIndex()
 	require.Nil(err)
-	require.Equal([]string{"1", "2", "4", "3", "5"}, getTodoBodies(false, todos))
+	require.True(status.OK())
 }
 
-func TestRoostMoveTodoBeginningOfList(t *testing.T) {
+func TestRoostTodosDueBetween(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
 	require.Nil(err)
 	require.Nil(roost1.Initialize(password))
-	group, err := roost1.CreateGroup("group1")
+	group1, err := roost1.CreateGroup("group1")
 	require.Nil(err)
-	topics, err := group.Topics()
+	group2, err := roost1.CreateGroup("group2")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
+	topics1, err := group1.Topics()
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
+	topics2, err := group2.Topics()
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
+	todo1, err := group1.CreateTodo(topics1.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
+	todo2, err := group2.CreateTodo(topics2.Topic(0).ID, "wash the car")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
+	todo3, err := group2.CreateTodo(topics2.Topic(0).ID, "paint the fence")
 	require.Nil(err)
-	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 0))
-	todos, err := group.Todos(topics.Topic(0).ID)
+	_, err = group2.CreateTodo(topics2.Topic(0).ID, "someday")
 	require.Nil(err)
-	require.Equal([]string{"4", "1", "2", "3", "5"}, getTodoBodies(false, todos))
+	require.Nil(group1.SetTodoDue(todo1.ID, 2000, 1900))
+	require.Nil(group2.SetTodoDue(todo2.ID, 1000, 0))
+	require.Nil(group2.SetTodoDue(todo3.ID, 5000, 0))
+
+	todo1, err = group1.Todo(todo1.ID)
+	require.Nil(err)
+	require.Equal(float64(2000), todo1.DueAt)
+	require.Equal(float64(1900), todo1.RemindAt)
+
+	due, err := roost1.TodosDueBetween(0, 3000)
+	require.Nil(err)
+	require.Equal(2, due.Count)
+	require.Equal("wash the car", due.Todo(0).Body)
+	require.Equal("mow the lawn", due.Todo(1).Body)
+
+	updater := group2.TodoUpdater()
+	updater.MarkComplete(todo2.ID, true)
+	require.Nil(updater.Commit())
+	due, err = roost1.TodosDueBetween(0, 3000)
+	require.Nil(err)
+	require.Equal(1, due.Count)
+	require.Equal("mow the lawn", due.Todo(0).Body)
 }
 
-func TestRoostMoveTodoEndOfList(t *testing.T) {
+func TestRoostTodoReminder(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -279,68 +594,130 @@ func TestRoostMoveTodoEndOfList(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
-	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
-	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
-	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
-	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
-	require.Nil(err)
-	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 4))
-	todos, err := group.Todos(topics.Topic(0).ID)
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "call the dentist")
 	require.Nil(err)
-	require.Equal([]string{"1", "2", "3", "5", "4"}, getTodoBodies(false, todos))
+
+	reminders := make(chan *ReminderUpdate)
+	go func() {
+		filter := &UpdateFilter{}
+		filter.AddType(UpdateReminder)
+		u := roost1.Subscribe(filter)
+		defer u.Close()
+		u.Next()
+		reminders <- u.ReminderUpdate()
+	}()
+	remindAt := now() + 0.5
+	require.Nil(group.SetTodoDue(todo.ID, remindAt+60, remindAt))
+
+	select {
+	case reminder := <-reminders:
+		require.Equal(todo.ID, reminder.TodoID)
+		require.Equal(group.GroupID, reminder.GroupID)
+		require.Equal("call the dentist", reminder.Body)
+		require.Equal(remindAt, reminder.RemindAt)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for reminder")
+	}
 }
 
-func TestRoostCreateTopic(t *testing.T) {
+func TestRoostTodoReminderWhileLocked(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
-	defer teardownRoost(roost1, "roost1")
+	defer func() { teardownRoost(roost1, "roost1") }()
 	require.Nil(err)
 	require.Nil(roost1.Initialize(password))
 	group, err := roost1.CreateGroup("group1")
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	require.Equal(1, topics.Count)
-	topic, err := group.CreateTopic("some topic")
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "call the dentist")
 	require.Nil(err)
-	require.Equal("some topic", topic.Label)
+	remindAt := now() + 0.2
+	require.Nil(group.SetTodoDue(todo.ID, remindAt+60, remindAt))
+	require.Nil(roost1.Shutdown())
+	time.Sleep(300 * time.Millisecond)
+
+	roost1, err = MakeRoostWithStrongKey("roost1", "")
+	require.Nil(err)
+	filter := &UpdateFilter{}
+	filter.AddType(UpdateReminder)
+	u := roost1.Subscribe(filter)
+	defer u.Close()
+	require.Nil(roost1.Unlock(password))
+	reminders := make(chan *ReminderUpdate)
+	go func() {
+		u.Next()
+		if u.Type() == UpdateReminder {
+			reminders <- u.ReminderUpdate()
+		}
+	}()
+	select {
+	case reminder := <-reminders:
+		require.Equal(todo.ID, reminder.TodoID)
+		require.Equal(remindAt, reminder.RemindAt)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for reminder")
+	}
+
+	// the reminder isn't emitted again the next time Roost is unlocked
+	require.Nil(roost1.Shutdown())
+	roost1, err = MakeRoostWithStrongKey("roost1", "")
+	require.Nil(err)
+	u = roost1.Subscribe(filter)
+	defer u.Close()
+	require.Nil(roost1.Unlock(password))
+	time.AfterFunc(500*time.Millisecond, u.Close)
+	u.Next()
+	require.Equal(UpdateFinished, u.Type())
 }
 
-func TestRoostMoveTopicInList(t *testing.T) {
+func TestRoostAssignTodo(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
 	require.Nil(err)
 	require.Nil(roost1.Initialize(password))
-	group, err := roost1.CreateGroup("group1")
+	group1, err := roost1.CreateGroup("group1")
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("one", true)
+	group2, err := roost1.CreateGroup("group2")
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("two", true)
+	topics1, err := group1.Topics()
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("three", true)
+	topics2, err := group2.Topics()
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("four", false)
+	todo1, err := group1.CreateTodo(topics1.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("five", false)
+	todo2, err := group2.CreateTodo(topics2.Topic(0).ID, "wash the car")
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("six", false)
+	todo3, err := group2.CreateTodo(topics2.Topic(0).ID, "paint the fence")
 	require.Nil(err)
-	_, err = group.CreateTopicPinned("seven", false)
+	require.Nil(todo1.AssigneeID)
+
+	require.Nil(group1.AssignTodo(todo1.ID, group1.IdentityTag))
+	require.Nil(group2.AssignTodo(todo2.ID, group2.IdentityTag))
+	require.Nil(group2.AssignTodo(todo3.ID, []byte{1, 2, 3, 4}))
+	require.NotNil(group2.AssignTodo(todo3.ID, []byte{1, 2, 3}))
+
+	todo1, err = group1.Todo(todo1.ID)
 	require.Nil(err)
+	require.Equal(group1.IdentityTag, todo1.AssigneeID)
 
-	require.Nil(group.MoveTopic(false, 1, 2))
-	topics, err := group.Topics()
+	assigned, err := roost1.TodosAssignedToMe()
 	require.Nil(err)
-	require.Equal([]string{"home", "five", "four", "six", "seven"}, getTopicLabels(false, topics))
+	require.Equal(2, assigned.Count)
+	require.ElementsMatch([]string{"mow the lawn", "wash the car"}, []string{assigned.Todo(0).Body, assigned.Todo(1).Body})
+
+	require.Nil(group1.AssignTodo(todo1.ID, nil))
+	todo1, err = group1.Todo(todo1.ID)
+	require.Nil(err)
+	require.Nil(todo1.AssigneeID)
+	assigned, err = roost1.TodosAssignedToMe()
+	require.Nil(err)
+	require.Equal(1, assigned.Count)
+	require.Equal("wash the car", assigned.Todo(0).Body)
 }
 
-func TestRoostMoveTopicInListFromZeroList(t *testing.T) {
+func TestRoostRecurringTodo(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -348,28 +725,84 @@ func TestRoostMoveTopicInListFromZeroList(t *testing.T) {
 	require.Nil(roost1.Initialize(password))
 	group, err := roost1.CreateGroup("group1")
 	require.Nil(err)
-	_, err = group.createTopicPinned("one", true, 0)
-	require.Nil(err)
-	_, err = group.createTopicPinned("two", true, 0)
+	topics, err := group.Topics()
 	require.Nil(err)
-	_, err = group.createTopicPinned("three", true, 0)
+	topicID := topics.Topic(0).ID
+	_, err = group.CreateTodo(topicID, "water the plants")
 	require.Nil(err)
-	_, err = group.createTopicPinned("four", false, 0)
+	todo, err := group.CreateTodo(topicID, "take out the bins")
 	require.Nil(err)
-	_, err = group.createTopicPinned("five", false, 0)
+	require.NotNil(group.SetTodoRecurrence(todo.ID, "FREQ=FORTNIGHTLY"))
+	require.Nil(group.SetTodoRecurrence(todo.ID, "FREQ=WEEKLY"))
+	dueAt := float64(time.Date(2023, time.January, 4, 9, 30, 0, 0, time.Local).Unix())
+	require.Nil(group.SetTodoDue(todo.ID, dueAt, dueAt-3600))
+	require.Nil(group.AssignTodo(todo.ID, group.IdentityTag))
+
+	updater := group.TodoUpdater()
+	updater.MarkComplete(todo.ID, true)
+	require.Nil(updater.Commit())
+
+	todos, err := group.Todos(topicID)
 	require.Nil(err)
-	_, err = group.createTopicPinned("six", false, 0)
+	require.Equal(1, todos.CompleteCount)
+	require.Equal(2, todos.IncompleteCount)
+	require.Equal([]string{"water the plants", "take out the bins"}, getTodoBodies(false, todos))
+	next := todos.IncompleteTodo(1)
+	require.NotEqual(todo.ID, next.ID)
+	require.Equal(todo.Position, next.Position)
+	require.Equal(float64(time.Date(2023, time.January, 11, 9, 30, 0, 0, time.Local).Unix()), next.DueAt)
+	require.Equal(next.DueAt-3600, next.RemindAt)
+	require.Equal("FREQ=WEEKLY", next.Recurrence)
+	require.Equal(group.IdentityTag, next.AssigneeID)
+	require.Equal(todo.ID, next.RecurrenceOf)
+	require.Equal(1, next.Sequence)
+
+	// completing the same occurrence again doesn't create another next occurrence
+	updater.MarkComplete(todo.ID, false)
+	require.Nil(updater.Commit())
+	updater.MarkComplete(todo.ID, true)
+	require.Nil(updater.Commit())
+	todos, err = group.Todos(topicID)
 	require.Nil(err)
-	_, err = group.createTopicPinned("seven", false, 0)
+	require.Equal(1, todos.CompleteCount)
+	require.Equal(2, todos.IncompleteCount)
+
+	// a duplicate of the next occurrence, as created by another member completing the todo while offline, is removed
+	writer := roost1.slick.EAVWriter(group.group)
+	writer.Insert("todos", map[string]interface{}{
+		"body":          next.Body,
+		"topic_id":      topicID,
+		"position":      next.Position,
+		"recurrence":    next.Recurrence,
+		"recurrence_of": todo.ID,
+		"sequence":      1,
+	})
+	require.Nil(writer.Execute())
+	require.Eventually(func() bool {
+		todos, err := group.Todos(topicID)
+		require.Nil(err)
+		return todos.IncompleteCount == 2
+	}, 2*time.Second, 50*time.Millisecond)
+	todos, err = group.Todos(topicID)
 	require.Nil(err)
+	survivor := todos.IncompleteTodo(1)
+	if bytes.Compare(writer.InsertIDs[0][:], next.ID) < 0 {
+		require.Equal(writer.InsertIDs[0][:], survivor.ID)
+	} else {
+		require.Equal(next.ID, survivor.ID)
+	}
+	next = survivor
 
-	require.Nil(group.MoveTopic(false, 1, 2))
-	topics, err := group.Topics()
+	require.Nil(group.SetTodoRecurrence(next.ID, ""))
+	updater.MarkComplete(next.ID, true)
+	require.Nil(updater.Commit())
+	todos, err = group.Todos(topicID)
 	require.Nil(err)
-	require.Equal([]string{"home", "five", "four", "six", "seven"}, getTopicLabels(false, topics))
+	require.Equal(2, todos.CompleteCount)
+	require.Equal(1, todos.IncompleteCount)
 }
 
-func TestRoostUpdateTopic(t *testing.T) {
+func TestRoostMoveTodoInList(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -379,65 +812,1126 @@ func TestRoostUpdateTopic(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	require.Equal(1, topics.Count)
-	topic, err := group.CreateTopic("some topic")
+	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
 	require.Nil(err)
-	require.Equal("some topic", topic.Label)
-	topic.Label = "new topic"
-	require.Nil(group.UpdateTopic(topic))
-	getTopic, err := group.Topic(topic.ID)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
+	require.Nil(err)
+	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 2))
+	todos, err := group.Todos(topics.Topic(0).ID)
+	require.Nil(err)
+	require.Equal([]string{"1", "2", "4", "3", "5"}, getTodoBodies(false, todos))
+}
+
+func TestRoostMoveTodoBeginningOfList(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
+	require.Nil(err)
+	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 0))
+	todos, err := group.Todos(topics.Topic(0).ID)
+	require.Nil(err)
+	require.Equal([]string{"4", "1", "2", "3", "5"}, getTodoBodies(false, todos))
+}
+
+func TestRoostMoveTodoEndOfList(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "1")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "2")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "3")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "4")
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "5")
+	require.Nil(err)
+	require.Nil(group.MoveTodo(false, topics.Topic(0).ID, 3, 4))
+	todos, err := group.Todos(topics.Topic(0).ID)
+	require.Nil(err)
+	require.Equal([]string{"1", "2", "3", "5", "4"}, getTodoBodies(false, todos))
+}
+
+func TestRoostSubtodos(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	topicID := topics.Topic(0).ID
+	parent, err := group.CreateTodo(topicID, "pack for the trip")
+	require.Nil(err)
+	subtodoIDs := make([][]byte, 0, 3)
+	for _, body := range []string{"passport", "charger", "socks"} {
+		subtodo, err := group.CreateSubtodo(parent.ID, body)
+		require.Nil(err)
+		require.Equal(parent.ID, subtodo.ParentID)
+		require.Equal(topicID, subtodo.TopicID)
+		subtodoIDs = append(subtodoIDs, subtodo.ID)
+	}
+	_, err = group.CreateSubtodo(subtodoIDs[0], "nested")
+	require.NotNil(err)
+
+	todos, err := group.Todos(topicID)
+	require.Nil(err)
+	require.Equal([]string{"pack for the trip"}, getTodoBodies(false, todos))
+	topic, err := group.Topic(topicID)
+	require.Nil(err)
+	require.Equal(1, topic.IncompleteTodoCount)
+
+	require.Nil(group.MoveSubtodo(false, parent.ID, 2, 0))
+	subtodos, err := group.Subtodos(parent.ID)
+	require.Nil(err)
+	require.Equal([]string{"socks", "passport", "charger"}, getTodoBodies(false, subtodos))
+
+	updater := group.TodoUpdater()
+	updater.MarkComplete(subtodoIDs[0], true)
+	updater.MarkComplete(subtodoIDs[1], true)
+	require.Nil(updater.Commit())
+	parent, err = group.Todo(parent.ID)
+	require.Nil(err)
+	require.Equal(3, parent.SubtodoCount)
+	require.Equal(2, parent.CompletedSubtodoCount)
+	subtodos, err = group.Subtodos(parent.ID)
+	require.Nil(err)
+	require.Equal([]string{"socks"}, getTodoBodies(false, subtodos))
+	require.Equal(2, subtodos.CompleteCount)
+
+	require.Nil(group.DeleteTodo(subtodoIDs[2]))
+	parent, err = group.Todo(parent.ID)
+	require.Nil(err)
+	require.Equal(2, parent.SubtodoCount)
+	require.Equal(2, parent.CompletedSubtodoCount)
+
+	require.Nil(group.DeleteTodo(parent.ID))
+	subtodo, err := group.Todo(subtodoIDs[0])
+	require.Nil(err)
+	require.True(subtodo.Deleted)
+}
+
+func TestRoostCreateTopic(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal(1, topics.Count)
+	topic, err := group.CreateTopic("some topic")
+	require.Nil(err)
+	require.Equal("some topic", topic.Label)
+}
+
+func TestRoostTopicsAfterPinned(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("pinned", true)
+	require.Nil(err)
+	_, err = group.CreateTopic("unpinned")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal(3, topics.Count)
+	labels := make([]string, topics.Count)
+	for i := range labels {
+		labels[i] = topics.Topic(i).Label
+	}
+	require.Equal([]string{"pinned", "home", "unpinned"}, labels)
+}
+
+func TestRoostMoveTopicInList(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("one", true)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("two", true)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("three", true)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("four", false)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("five", false)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("six", false)
+	require.Nil(err)
+	_, err = group.CreateTopicPinned("seven", false)
+	require.Nil(err)
+
+	require.Nil(group.MoveTopic(false, 1, 2))
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal([]string{"home", "five", "four", "six", "seven"}, getTopicLabels(false, topics))
+}
+
+func TestRoostMoveTopicInListFromZeroList(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	_, err = group.createTopicPinned("one", true, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("two", true, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("three", true, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("four", false, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("five", false, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("six", false, 0)
+	require.Nil(err)
+	_, err = group.createTopicPinned("seven", false, 0)
+	require.Nil(err)
+
+	require.Nil(group.MoveTopic(false, 1, 2))
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal([]string{"home", "five", "four", "six", "seven"}, getTopicLabels(false, topics))
+}
+
+func TestRoostUpdateTopic(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal(1, topics.Count)
+	topic, err := group.CreateTopic("some topic")
+	require.Nil(err)
+	require.Equal("some topic", topic.Label)
+	topic.Label = "new topic"
+	require.Nil(group.UpdateTopic(topic))
+	getTopic, err := group.Topic(topic.ID)
 	require.Nil(err)
 	require.Equal("new topic", getTopic.Label)
 }
 
-func TestRoostCreateMessages(t *testing.T) {
+func TestRoostDeleteTopic(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topic, err := group.CreateTopic("chores")
+	require.Nil(err)
+	todo, err := group.CreateTodo(topic.ID, "mow the lawn")
+	require.Nil(err)
+	message, err := group.CreateMessage(topic.ID, "the lawn is long")
+	require.Nil(err)
+	require.Nil(group.SetReaction(message.ID, "😅", true))
+
+	require.Nil(group.DeleteTopic(topic.ID))
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal([]string{"home"}, getTopicLabels(false, topics))
+	getTopic, err := group.Topic(topic.ID)
+	require.Nil(err)
+	require.True(getTopic.Deleted)
+	getTodo, err := group.Todo(todo.ID)
+	require.Nil(err)
+	require.True(getTodo.Deleted)
+	getMessage, err := group.Message(message.ID)
+	require.Nil(err)
+	require.True(getMessage.Deleted)
+	reactions, err := group.Reactions(message.ID)
+	require.Nil(err)
+	require.Equal(0, reactions.Count)
+	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(0, result.Count)
+}
+
+func TestRoostArchiveTopic(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topic, err := group.CreateTopic("chores")
+	require.Nil(err)
+	todo, err := group.CreateTodo(topic.ID, "mow the lawn")
+	require.Nil(err)
+
+	require.Nil(group.ArchiveTopic(topic.ID))
+	topics, err := group.Topics()
+	require.Nil(err)
+	require.Equal([]string{"home"}, getTopicLabels(false, topics))
+	archived, err := group.ArchivedTopics()
+	require.Nil(err)
+	require.Equal(1, archived.Count)
+	require.Equal("chores", archived.Topic(0).Label)
+	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	require.Equal(todo.ID, result.Result(0).EntityID)
+
+	require.Nil(group.UnarchiveTopic(topic.ID))
+	topics, err = group.Topics()
+	require.Nil(err)
+	require.Equal([]string{"home", "chores"}, getTopicLabels(false, topics))
+	archived, err = group.ArchivedTopics()
+	require.Nil(err)
+	require.Equal(0, archived.Count)
+	result, err = roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	require.Equal(todo.ID, result.Result(0).EntityID)
+	status, err := roost1.VerifySearchIndex()
+	require.Nil(err)
+	require.True(status.OK())
+}
+
+func TestRoostCreateMessages(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	u := roost1.Updates()
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	for i := 0; i != 43; i++ {
+		_, err := group.CreateMessage(topics.Topic(0).ID, fmt.Sprintf("hello %d", i))
+		require.Nil(err)
+	}
+
+	page1, err := group.Messages(topics.Topic(0).ID, "")
+	require.Nil(err)
+	require.Equal(20, page1.Count)
+	require.Equal(false, page1.AtEnd)
+	page2, err := group.Messages(topics.Topic(0).ID, page1.Cursor)
+	require.Nil(err)
+	require.Equal(20, page2.Count)
+	require.Equal(false, page2.AtEnd)
+	page3, err := group.Messages(topics.Topic(0).ID, page2.Cursor)
+	require.Nil(err)
+	require.Equal(3, page3.Count)
+	require.Equal(true, page3.AtEnd)
+	entityCount := 0
+	require.Nil(roost1.Shutdown())
+updatesLoop:
+	for {
+		u.Next()
+		switch u.Type() {
+		case UpdateAppState:
+			if u.AppState().State == slick.StateInitialized {
+				break updatesLoop
+			}
+		case UpdateEntityUpdate:
+			if u.ViewEntityUpdate().ViewName == "messages" {
+				entityCount++
+			}
+		}
+	}
+	require.Equal(43, entityCount)
+}
+
+func TestRoostMessagesSameTimestamp(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	topicID := topics.Topic(0).ID
+	first, err := group.CreateMessage(topicID, "first")
+	require.Nil(err)
+
+	// messages from different authors created within the same microsecond
+	writer := roost1.slick.EAVWriter(group.group)
+	for i := 0; i != 2*MessagesPageSize+5; i++ {
+		id := make([]byte, 16)
+		copy(id, first.ID)
+		binary.BigEndian.PutUint64(id[0:8], binary.BigEndian.Uint64(first.ID[0:8])+1000)
+		id[15] = byte(i)
+		writer.Update("messages", id, map[string]interface{}{
+			"body":     fmt.Sprintf("same %d", i),
+			"topic_id": topicID,
+		})
+	}
+	require.Nil(writer.Execute())
+	last, err := group.CreateMessage(topicID, "last")
+	require.Nil(err)
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		page, err := group.Messages(topicID, cursor)
+		require.Nil(err)
+		for i := 0; i != page.Count; i++ {
+			require.False(seen[string(page.Message(i).ID)])
+			seen[string(page.Message(i).ID)] = true
+		}
+		if page.AtEnd {
+			require.Equal(first.ID, page.Message(page.Count-1).ID)
+			break
+		}
+		cursor = page.Cursor
+	}
+	require.Equal(2*MessagesPageSize+7, len(seen))
+
+	seen = map[string]bool{string(first.ID): true}
+	cursor = messageCursor(first.ID)
+	for {
+		page, err := group.MessagesAfter(topicID, cursor)
+		require.Nil(err)
+		for i := 0; i != page.Count; i++ {
+			require.False(seen[string(page.Message(i).ID)])
+			seen[string(page.Message(i).ID)] = true
+		}
+		if page.AtNewest {
+			require.Equal(last.ID, page.Message(0).ID)
+			break
+		}
+		cursor = page.NewerCursor
+	}
+	require.Equal(2*MessagesPageSize+7, len(seen))
+
+	_, err = group.Messages(topicID, "1688671201.123")
+	require.NotNil(err)
+}
+
+func TestRoostMessagesAround(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	topicID := topics.Topic(0).ID
+	messages := make([]*Message, 43)
+	for i := 0; i != 43; i++ {
+		messages[i], err = group.CreateMessage(topicID, fmt.Sprintf("hello %d", i))
+		require.Nil(err)
+	}
+
+	newest, err := group.Messages(topicID, "")
+	require.Nil(err)
+	require.True(newest.AtNewest)
+
+	around, err := group.MessagesAround(topicID, messages[20].ID)
+	require.Nil(err)
+	require.Equal(20, around.Count)
+	require.Equal("hello 30", around.Message(0).Body)
+	require.Equal("hello 20", around.Message(10).Body)
+	require.Equal("hello 11", around.Message(19).Body)
+	require.False(around.AtEnd)
+	require.False(around.AtNewest)
+
+	newer, err := group.MessagesAfter(topicID, around.NewerCursor)
+	require.Nil(err)
+	require.Equal(12, newer.Count)
+	require.Equal("hello 42", newer.Message(0).Body)
+	require.Equal("hello 31", newer.Message(11).Body)
+	require.True(newer.AtNewest)
+
+	older, err := group.Messages(topicID, around.Cursor)
+	require.Nil(err)
+	require.Equal(11, older.Count)
+	require.Equal("hello 10", older.Message(0).Body)
+	require.True(older.AtEnd)
+	require.False(older.AtNewest)
+
+	newer, err = group.MessagesAfter(topicID, older.NewerCursor)
+	require.Nil(err)
+	require.Equal(20, newer.Count)
+	require.Equal("hello 30", newer.Message(0).Body)
+	require.False(newer.AtNewest)
+
+	_, err = group.MessagesAround(topics.Topic(0).ID, []byte("missing"))
+	require.NotNil(err)
+}
+
+func TestRoostMarkMessageRead(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group1, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics1, err := group1.Topics()
+	require.Nil(err)
+	_, err = group1.CreateMessage(topics1.Topic(0).ID, "hello there")
+	require.Nil(err)
+
+	roost2, _, err := makeRoost("roost2")
+	defer teardownRoost(roost2, "roost2")
+	require.Nil(err)
+	require.Nil(roost2.Initialize(password))
+
+	invite, err := group1.Invite("invite password")
+	require.Nil(err)
+
+	_, err = roost2.AcceptInvite(invite, "invite password")
+	require.Nil(err)
+	require.Eventually(func() bool {
+		groups, err := roost2.Groups()
+		require.Nil(err)
+		return groups.Count == 1
+	}, 10*time.Second, 100*time.Millisecond)
+
+	groups2, err := roost2.Groups()
+	require.Nil(err)
+	topics2, err := groups2.Group(0).Topics()
+	require.Nil(err)
+	topic2 := topics2.Topic(0)
+	require.Nil(err)
+	require.Equal(1, topic2.UnreadMessageCount)
+	require.Nil(groups2.Group(0).MarkTopicRead(topic2.ID))
+	topic2, err = groups2.Group(0).Topic(topic2.ID)
+	require.Nil(err)
+	require.Equal(0, topic2.UnreadMessageCount)
+}
+
+func TestRoostUpdateMessage(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	newTopic, err := group.CreateTopic("some topic")
+	require.Nil(err)
+	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
+	require.Equal("hello there", message.Body)
+	require.Equal(topics.Topic(0).ID, message.TopicID)
+	require.Nil(err)
+	message.Body = "hello there again"
+	message.TopicID = newTopic.ID
+	require.Nil(group.UpdateMessage(message))
+	getMessage, err := group.Message(message.ID)
+	require.Nil(err)
+	require.Equal("hello there again", getMessage.Body)
+	require.Equal(newTopic.ID, getMessage.TopicID)
+}
+
+func TestRoostMessageReplies(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	topicID := topics.Topic(0).ID
+	parent, err := group.CreateMessage(topicID, "who wants pizza?")
+	require.Nil(err)
+	require.Nil(parent.ReplyToID)
+	for i := 0; i != 23; i++ {
+		reply, err := group.CreateReply(topicID, parent.ID, fmt.Sprintf("me %d", i))
+		require.Nil(err)
+		require.Equal(parent.ID, reply.ReplyToID)
+	}
+	todo, err := group.CreateTodo(topicID, "order pizza")
+	require.Nil(err)
+	todoReply, err := group.CreateReply(topicID, todo.ID, "on it")
+	require.Nil(err)
+	require.Equal(todo.ID, todoReply.ReplyToID)
+	_, err = group.CreateReply(topicID, []byte("nope"), "hello?")
+	require.NotNil(err)
+
+	page1, err := group.Thread(parent.ID, "")
+	require.Nil(err)
+	require.Equal(20, page1.Count)
+	require.False(page1.AtEnd)
+	require.Equal("me 0", page1.Message(0).Body)
+	require.Equal("me 19", page1.Message(19).Body)
+	page2, err := group.Thread(parent.ID, page1.Cursor)
+	require.Nil(err)
+	require.Equal(3, page2.Count)
+	require.True(page2.AtEnd)
+	require.Equal("me 20", page2.Message(0).Body)
+
+	thread, err := group.Thread(todo.ID, "")
+	require.Nil(err)
+	require.Equal(1, thread.Count)
+	require.Equal("on it", thread.Message(0).Body)
+}
+
+func TestRoostDeleteMessage(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	topicID := topics.Topic(0).ID
+	_, err = group.CreateMessage(topicID, "hello there")
+	require.Nil(err)
+
+	group.group.AuthorTag = [7]byte{1, 2, 3, 4, 5, 6, 7}
+	writer := roost1.slick.EAVWriter(group.group)
+	writer.Insert("messages", map[string]interface{}{
+		"body":     "mistaken message",
+		"topic_id": topicID,
+	})
+	require.Nil(writer.Execute())
+	mistakeID := writer.InsertIDs[0][:]
+	require.Nil(group.SetReaction(mistakeID, "😅", true))
+	topic, err := group.Topic(topicID)
+	require.Nil(err)
+	require.Equal(1, topic.UnreadMessageCount)
+
+	require.Nil(group.DeleteMessage(mistakeID))
+	message, err := group.Message(mistakeID)
+	require.Nil(err)
+	require.True(message.Deleted)
+	require.Equal("", message.Body)
+	messages, err := group.Messages(topicID, "")
+	require.Nil(err)
+	require.Equal(1, messages.Count)
+	require.Equal("hello there", messages.Message(0).Body)
+	topic, err = group.Topic(topicID)
+	require.Nil(err)
+	require.Equal(0, topic.UnreadMessageCount)
+	reactions, err := group.Reactions(mistakeID)
+	require.Nil(err)
+	require.Equal(0, reactions.Count)
+	result, err := roost1.Search(group.GroupID, "mistaken", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(0, result.Count)
+}
+
+func TestRoostReactionsSetAndUnset(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
+	require.Equal("hello there", message.Body)
+	require.Equal(topics.Topic(0).ID, message.TopicID)
+	require.Nil(err)
+	require.Nil(group.SetReaction(message.ID, "😶‍🌫️", true))
+	require.Nil(group.SetReaction(message.ID, "😅", true))
+	reactions, err := group.Reactions(message.ID)
+	require.Nil(err)
+	require.Equal(2, reactions.Count)
+	require.Nil(group.SetReaction(message.ID, "😶‍🌫️", false))
+	reactions, err = group.Reactions(message.ID)
+	require.Nil(err)
+	require.Equal(1, reactions.Count)
+}
+
+func TestRoostReactionSummaries(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	message1, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
+	require.Nil(err)
+	message2, err := group.CreateMessage(topics.Topic(0).ID, "general kenobi")
+	require.Nil(err)
+	message3, err := group.CreateMessage(topics.Topic(0).ID, "nobody reacts to this")
+	require.Nil(err)
+	require.Nil(group.SetReaction(message1.ID, "👍", true))
+	require.Nil(group.SetReaction(message1.ID, "😅", true))
+	require.Nil(group.SetReaction(message2.ID, "😅", true))
+	require.Nil(group.SetReaction(message2.ID, "👍", true))
+	require.Nil(group.SetReaction(message2.ID, "👍", false))
+
+	// someone else reacts to the first message
+	authorTag := group.group.AuthorTag
+	group.group.AuthorTag = [7]byte{1, 2, 3, 4, 5, 6, 7}
+	writer := roost1.slick.EAVWriter(group.group)
+	group.group.AuthorTag = authorTag
+	writer.Insert("reactions", map[string]interface{}{
+		"entity_id": message1.ID,
+		"rune":      "😅",
+	})
+	writer.Insert("reactions", map[string]interface{}{
+		"entity_id": message1.ID,
+		"rune":      "🎉",
+	})
+	require.Nil(writer.Execute())
+
+	entityIDs := NewIDList()
+	entityIDs.Add(message3.ID)
+	entityIDs.Add(message1.ID)
+	entityIDs.Add(message2.ID)
+	summaries, err := group.ReactionSummaries(entityIDs)
+	require.Nil(err)
+	require.Equal(3, summaries.Count)
+	require.Equal(message3.ID, summaries.Summary(0).EntityID)
+	require.Equal(0, summaries.Summary(0).Count)
+
+	summary := summaries.Summary(1)
+	require.Equal(message1.ID, summary.EntityID)
+	require.Equal(3, summary.Count)
+	require.Equal("👍", summary.RuneReaction(0).Rune)
+	require.Equal(1, summary.RuneReaction(0).Count)
+	require.True(summary.RuneReaction(0).Mine)
+	require.Equal(group.IdentityTag, summary.RuneReaction(0).IdentityID(0))
+	require.Equal("😅", summary.RuneReaction(1).Rune)
+	require.Equal(2, summary.RuneReaction(1).Count)
+	require.True(summary.RuneReaction(1).Mine)
+	require.Equal(group.IdentityTag, summary.RuneReaction(1).IdentityID(0))
+	require.Equal([]byte{1, 2, 3, 4}, summary.RuneReaction(1).IdentityID(1))
+	require.Equal("🎉", summary.RuneReaction(2).Rune)
+	require.Equal(1, summary.RuneReaction(2).Count)
+	require.False(summary.RuneReaction(2).Mine)
+
+	summary = summaries.Summary(2)
+	require.Equal(1, summary.Count)
+	require.Equal("😅", summary.RuneReaction(0).Rune)
+
+	summary, err = group.ReactionSummary(message2.ID)
+	require.Nil(err)
+	require.Equal(1, summary.Count)
+	require.Equal(1, summary.RuneReaction(0).Count)
+
+	// reactions to an id listed twice are counted once
+	entityIDs = NewIDList()
+	entityIDs.Add(message1.ID)
+	entityIDs.Add(message1.ID)
+	summaries, err = group.ReactionSummaries(entityIDs)
+	require.Nil(err)
+	require.Equal(2, summaries.Count)
+	require.Same(summaries.Summary(0), summaries.Summary(1))
+	require.Equal(3, summaries.Summary(1).Count)
+	require.Equal(2, summaries.Summary(1).RuneReaction(1).Count)
+}
+
+func TestRoostReactionsTooManyRunes(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
+	require.Equal("hello there", message.Body)
+	require.Equal(topics.Topic(0).ID, message.TopicID)
+	require.Nil(err)
+	err = group.SetReaction(message.ID, "😶‍🌫️😀", true)
+	require.ErrorContains(err, "got 2")
+}
+
+func TestExternalInvite(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "hey there!")
+	require.Nil(err)
+
+	roost2, _, err := makeRoost("roost2")
+	defer teardownRoost(roost2, "roost2")
+	require.Nil(err)
+	require.Nil(roost2.Initialize(password))
+
+	invite, err := group.Invite("invite password")
+	require.Nil(err)
+
+	_, err = roost2.AcceptInvite(invite, "invite password")
+	require.Nil(err)
+	require.Eventually(func() bool {
+		groups, err := roost2.Groups()
+		require.Nil(err)
+		return groups.Count == 1
+	}, 10*time.Second, 100*time.Millisecond)
+
+	groups, err := roost2.Groups()
+	require.Nil(err)
+	todos, err := groups.Group(0).Todos(topics.Topic(0).ID)
+	require.Nil(err)
+	require.Equal(1, todos.IncompleteCount)
+	require.Equal("hey there!", todos.IncompleteTodo(0).Body)
+	require.Equal(0, todos.CompleteCount)
+}
+
+func TestRoostMembersAndProfiles(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	require.Nil(roost1.SetProfile("alice", nil))
+	profile, err := roost1.Profile()
+	require.Nil(err)
+	require.Equal("alice", profile.Name)
+	group1, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+
+	members, err := group1.Members()
+	require.Nil(err)
+	require.Equal(1, members.Count)
+	require.Equal(group1.IdentityTag, members.Member(0).IdentityID)
+	require.Equal("alice", members.Member(0).Name)
+	require.True(members.Member(0).Me)
+
+	roost2, _, err := makeRoost("roost2")
+	defer teardownRoost(roost2, "roost2")
+	require.Nil(err)
+	require.Nil(roost2.Initialize(password))
+	require.Nil(roost2.SetProfile("bob", []byte("avatar")))
+
+	invite, err := group1.Invite("invite password")
+	require.Nil(err)
+	_, err = roost2.AcceptInvite(invite, "invite password")
+	require.Nil(err)
+	require.Eventually(func() bool {
+		groups, err := roost2.Groups()
+		require.Nil(err)
+		return groups.Count == 1
+	}, 10*time.Second, 100*time.Millisecond)
+	groups2, err := roost2.Groups()
+	require.Nil(err)
+	group2 := groups2.Group(0)
+
+	// profiles are shared with groups joined after they were set
+	require.Eventually(func() bool {
+		members, err := group1.Members()
+		require.Nil(err)
+		return members.Count == 2 && members.Member(1).Name == "bob"
+	}, 10*time.Second, 100*time.Millisecond)
+	members, err = group1.Members()
+	require.Nil(err)
+	require.Equal(group2.IdentityTag, members.Member(1).IdentityID)
+	require.Equal([]byte("avatar"), members.Member(1).Avatar)
+	require.False(members.Member(1).Me)
+
+	// the profile is only shared the first time a group is synced
+	roost2.profilesLock.Lock()
+	require.True(roost2.profileShared[group2.group.ID])
+	roost2.profilesLock.Unlock()
+
+	// member tags are the identity tags profiles were written with
+	tags, err := groupIdentityTags(roost1.slick, group1.group.ID)
+	require.Nil(err)
+	require.ElementsMatch([][]byte{group1.IdentityTag[:], group2.IdentityTag[:]}, tags)
+
+	require.Nil(roost1.SetProfile("alice b", []byte("new avatar")))
+	require.Eventually(func() bool {
+		members, err := group2.Members()
+		require.Nil(err)
+		return members.Count == 2 && members.Member(1).Name == "alice b"
+	}, 10*time.Second, 100*time.Millisecond)
+	members, err = group2.Members()
+	require.Nil(err)
+	require.Equal("bob", members.Member(0).Name)
+	require.True(members.Member(0).Me)
+	require.Equal(group1.IdentityTag, members.Member(1).IdentityID)
+	require.Equal([]byte("new avatar"), members.Member(1).Avatar)
+
+	// removing the avatar
+	require.Nil(roost2.SetProfile("bob", nil))
+	members, err = group2.Members()
+	require.Nil(err)
+	require.Nil(members.Member(0).Avatar)
+}
+
+func TestDeviceGroupInvite(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "hey there!")
+	require.Nil(err)
+
+	roost2, _, err := makeRoost("roost2")
+	defer teardownRoost(roost2, "roost2")
+	require.Nil(err)
+	require.Nil(roost2.Initialize(password))
+
+	require.Nil(roost1.SetDeviceNameType("this is roost1", "Desktop"))
+	require.Nil(roost2.SetDeviceNameType("this is roost2", "iPhone"))
+
+	link, err := roost1.GetDeviceLink()
+	require.Nil(err)
+
+	require.Nil(roost2.LinkDevice(link))
+
+	require.Eventually(func() bool {
+		devices, err := roost1.Devices()
+		require.Nil(err)
+		return devices.Count == 2
+	}, 2*time.Second, 50*time.Millisecond)
+
+	devices, err := roost1.Devices()
+	require.Nil(err)
+
+	require.Equal("this is roost1", devices.Device(0).Name())
+	require.Equal("Desktop", devices.Device(0).Type())
+	require.Equal("this is roost2", devices.Device(1).Name())
+	require.Equal("iPhone", devices.Device(1).Type())
+
+	require.Eventually(func() bool {
+		devices, err := roost2.Devices()
+		require.Nil(err)
+		return devices.Count == 2
+	}, 2*time.Second, 50*time.Millisecond)
+
+	devices, err = roost2.Devices()
+	require.Nil(err)
+
+	require.Equal("this is roost1", devices.Device(0).Name())
+	require.Equal("Desktop", devices.Device(0).Type())
+	require.Equal("this is roost2", devices.Device(1).Name())
+	require.Equal("iPhone", devices.Device(1).Type())
+
+	require.Eventually(func() bool {
+		groups, err := roost2.Groups()
+		require.Nil(err)
+		return groups.Count == 1
+	}, 5*time.Second, 100*time.Millisecond)
+
+	groups, err := roost2.Groups()
+	require.Nil(err)
+	todos, err := groups.Group(0).Todos(topics.Topic(0).ID)
+	require.Nil(err)
+	require.Equal(1, todos.IncompleteCount)
+	require.Equal("hey there!", todos.IncompleteTodo(0).Body)
+}
+
+func TestRoostLeaveDeviceGroup(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	_, err = roost1.CreateGroup("group1")
+	require.Nil(err)
+	require.Nil(os.WriteFile("roost1/application", []byte("not roost's"), 0o600))
+
+	require.Nil(roost1.LeaveDeviceGroup())
+	require.Equal(StateNew, roost1.State)
+	_, err = os.Stat("roost1/data")
+	require.ErrorIs(err, os.ErrNotExist)
+	_, err = os.Stat("roost1/salt")
+	require.ErrorIs(err, os.ErrNotExist)
+	// files which Roost doesn't own are left alone
+	contents, err := os.ReadFile("roost1/application")
+	require.Nil(err)
+	require.Equal("not roost's", string(contents))
+
+	require.Nil(roost1.Initialize(password))
+	groups, err := roost1.Groups()
+	require.Nil(err)
+	require.Equal(0, groups.Count)
+}
+
+func TestDeviceGroupDevices(t *testing.T) {
+	require := require.New(t)
+	roost1, _, err := makeRoost("roost1")
+	defer teardownRoost(roost1, "roost1")
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+
+	roost2, _, err := makeRoost("roost2")
+	defer teardownRoost(roost2, "roost2")
+	require.Nil(err)
+	require.Nil(roost2.Initialize(password))
+
+	require.Nil(roost1.SetDeviceNameType("this is roost1", "Desktop"))
+	require.Nil(roost2.SetDeviceNameType("this is roost2", "iPhone"))
+
+	link, err := roost1.GetDeviceLink()
+	require.Nil(err)
+	require.Nil(roost2.LinkDevice(link))
+
+	require.Eventually(func() bool {
+		devices, err := roost1.Devices()
+		require.Nil(err)
+		return devices.Count == 2
+	}, 2*time.Second, 50*time.Millisecond)
+	require.Eventually(func() bool {
+		devices, err := roost2.Devices()
+		require.Nil(err)
+		return devices.Count == 2
+	}, 2*time.Second, 50*time.Millisecond)
+
+	devices, err := roost1.Devices()
+	require.Nil(err)
+	require.True(devices.Device(0).IsCurrent())
+	require.False(devices.Device(1).IsCurrent())
+	require.Equal("this is roost2", devices.Device(1).Name())
+	require.NotEqual(devices.Device(0).ID(), devices.Device(1).ID())
+}
+
+func TestRoostChangePassword(t *testing.T) {
+	require := require.New(t)
+	newPassword := "qwertyuiopasdfghjklzxcvbnmqwerty"
+	roost1, _, err := makeRoost("roost1")
+	defer func() { teardownRoost(roost1, "roost1") }()
+	require.Nil(err)
+	require.Nil(roost1.Initialize(password))
+	group, err := roost1.CreateGroup("group1")
+	require.Nil(err)
+	topics, err := group.Topics()
+	require.Nil(err)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
+	require.Nil(err)
+
+	require.ErrorContains(roost1.ChangePassword(newPassword, password), "old password is incorrect")
+	require.ErrorContains(roost1.ChangePassword(password, "too short"), "expected key of length 32")
+	require.Nil(roost1.ChangePassword(password, newPassword))
+	require.Equal(StateRunning, roost1.State)
+	_, err = roost1.Group(group.GroupID)
+	require.Nil(err)
+	require.Nil(roost1.Shutdown())
+
+	// simulate a password change which was interrupted
+	require.Nil(os.WriteFile("roost1/data.rekey", []byte("partial"), 0o600))
+	roost1, err = MakeRoostWithStrongKey("roost1", "")
+	require.Nil(err)
+	_, err = os.Stat("roost1/data.rekey")
+	require.ErrorIs(err, os.ErrNotExist)
+	require.NotNil(roost1.Unlock(password))
+	require.Nil(roost1.Unlock(newPassword))
+	groups, err := roost1.Groups()
+	require.Nil(err)
+	require.Equal(1, groups.Count)
+	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal("mow the <b>lawn</b>", result.Result(0).Text)
+}
+
+func TestRoostChangePasswordDerivedKey(t *testing.T) {
+	require := require.New(t)
+	deleteAll("roost1")
+	roost1, err := MakeRoost("roost1", "")
+	defer func() { teardownRoost(roost1, "roost1") }()
+	require.Nil(err)
+	require.Nil(roost1.Initialize("hunter2"))
+	_, err = roost1.CreateGroup("group1")
+	require.Nil(err)
+	require.Nil(roost1.ChangePassword("hunter2", "correct horse battery staple"))
+	require.Nil(roost1.Shutdown())
+
+	roost1, err = MakeRoost("roost1", "")
+	require.Nil(err)
+	require.NotNil(roost1.Unlock("hunter2"))
+	require.Nil(roost1.Unlock("correct horse battery staple"))
+	groups, err := roost1.Groups()
+	require.Nil(err)
+	require.Equal(1, groups.Count)
+}
+
+func TestRoostSearchGroup(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
-	u := roost1.Updates()
 	require.Nil(err)
 	require.Nil(roost1.Initialize(password))
-	group, err := roost1.CreateGroup("group1")
+	group, err := roost1.CreateGroup("grou1")
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	for i := 0; i != 43; i++ {
-		_, err := group.CreateMessage(topics.Topic(0).ID, fmt.Sprintf("hello %d", i))
-		require.Nil(err)
-	}
-
-	page1, err := group.Messages(topics.Topic(0).ID, "")
+	require.Equal(1, topics.Count)
+	todo1, err := group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	require.Equal(20, page1.Count)
-	require.Equal(false, page1.AtEnd)
-	page2, err := group.Messages(topics.Topic(0).ID, page1.Cursor)
+	require.Equal(float64(0), todo1.CompletedAt)
+	require.Equal(false, todo1.Deleted)
+	todo2, err := group.CreateTodo(topics.Topic(0).ID, "make my bed")
 	require.Nil(err)
-	require.Equal(20, page2.Count)
-	require.Equal(false, page2.AtEnd)
-	page3, err := group.Messages(topics.Topic(0).ID, page2.Cursor)
+	require.Equal(float64(0), todo2.CompletedAt)
+	require.Equal(false, todo2.Deleted)
+	require.Greater(todo2.Position, todo1.Position)
+
+	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	require.Equal(3, page3.Count)
-	require.Equal(true, page3.AtEnd)
-	entityCount := 0
-	require.Nil(roost1.Shutdown())
-updatesLoop:
-	for {
-		u.Next()
-		switch u.Type() {
-		case UpdateAppState:
-			if u.AppState().State == slick.StateInitialized {
-				break updatesLoop
-			}
-		case UpdateEntityUpdate:
-			if u.ViewEntityUpdate().viewName == "messages" {
-				entityCount++
-			}
-		}
-	}
-	require.Equal(43, entityCount)
+	require.Equal("mow the <b>lawn</b>", result.Result(0).Text)
+	require.Equal(todo1.ID, result.Result(0).EntityID)
+	require.Equal("todo", result.Result(0).Type)
 }
 
-func TestRoostMarkMessageRead(t *testing.T) {
+func TestRoostSearchAllGroups(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -445,41 +1939,42 @@ func TestRoostMarkMessageRead(t *testing.T) {
 	require.Nil(roost1.Initialize(password))
 	group1, err := roost1.CreateGroup("group1")
 	require.Nil(err)
+	group2, err := roost1.CreateGroup("group2")
+	require.Nil(err)
 	topics1, err := group1.Topics()
 	require.Nil(err)
-	_, err = group1.CreateMessage(topics1.Topic(0).ID, "hello there")
+	topics2, err := group2.Topics()
 	require.Nil(err)
-
-	roost2, _, err := makeRoost("roost2")
-	defer teardownRoost(roost2, "roost2")
+	_, err = group1.CreateTodo(topics1.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	require.Nil(roost2.Initialize(password))
-
-	invite, err := group1.Invite("invite password")
+	_, err = group2.CreateMessage(topics2.Topic(0).ID, "the lawn looks great")
 	require.Nil(err)
-
-	_, err = roost2.AcceptInvite(invite, "invite password")
+	_, err = group2.CreateTodo(topics2.Topic(0).ID, "water the lawn")
 	require.Nil(err)
-	require.Eventually(func() bool {
-		groups, err := roost2.Groups()
-		require.Nil(err)
-		return groups.Count == 1
-	}, 10*time.Second, 100*time.Millisecond)
 
-	groups2, err := roost2.Groups()
-	require.Nil(err)
-	topics2, err := groups2.Group(0).Topics()
+	result, err := roost1.Search(nil, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	topic2 := topics2.Topic(0)
+	require.Equal(3, result.Total)
+	require.Equal(3, result.Count)
+	groupNames := make([]string, result.Count)
+	for i := 0; i != result.Count; i++ {
+		groupNames[i] = result.Result(i).GroupName
+		require.Equal("home", result.Result(i).TopicName)
+	}
+	require.ElementsMatch([]string{"group1", "group2", "group2"}, groupNames)
+
+	result, err = roost1.Search(group2.GroupID, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	require.Equal(1, topic2.UnreadMessageCount)
-	require.Nil(groups2.Group(0).MarkTopicRead(topic2.ID))
-	topic2, err = groups2.Group(0).Topic(topic2.ID)
+	require.Equal(2, result.Total)
+	require.Equal(2, result.Count)
+	require.Equal("group2", result.Result(0).GroupName)
+
+	result, err = roost1.NextPage(result)
 	require.Nil(err)
-	require.Equal(0, topic2.UnreadMessageCount)
+	require.Equal(0, result.Count)
 }
 
-func TestRoostUpdateMessage(t *testing.T) {
+func TestRoostSearchPaging(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -489,22 +1984,56 @@ func TestRoostUpdateMessage(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	newTopic, err := group.CreateTopic("some topic")
-	require.Nil(err)
-	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
-	require.Equal("hello there", message.Body)
-	require.Equal(topics.Topic(0).ID, message.TopicID)
-	require.Nil(err)
-	message.Body = "hello there again"
-	message.TopicID = newTopic.ID
-	require.Nil(group.UpdateMessage(message))
-	getMessage, err := group.Message(message.ID)
-	require.Nil(err)
-	require.Equal("hello there again", getMessage.Body)
-	require.Equal(newTopic.ID, getMessage.TopicID)
+	writer := roost1.slick.EAVWriter(group.group)
+	for i := 0; i != PageSize+50; i++ {
+		writer.Insert("messages", map[string]interface{}{
+			"body":     fmt.Sprintf("lawn %s", strings.Repeat("grass ", i%7)),
+			"topic_id": topics.Topic(0).ID,
+		})
+	}
+	require.Nil(writer.Execute())
+
+	total := PageSize + 50
+	for _, order := range []int{SearchOrderRelevance, SearchOrderRecency} {
+		result, err := roost1.SearchWithQuery(&SearchQuery{Term: "lawn", Order: order})
+		require.Nil(err)
+		require.Equal(total, result.Total)
+		require.Equal(PageSize, result.Count)
+		require.False(result.AtEnd)
+		require.NotEqual("", result.Cursor)
+		seen := make(map[string]bool)
+		for i := 0; i != result.Count; i++ {
+			seen[string(result.Result(i).EntityID)] = true
+		}
+
+		// new entries and rebuilding the index don't shift the next page
+		_, err = group.CreateMessage(topics.Topic(0).ID, "lawn")
+		require.Nil(err)
+		require.Nil(roost1.RebuildSearchIndex())
+		result, err = roost1.NextPage(result)
+		require.Nil(err)
+		require.Equal(total, result.Total)
+		require.Equal(total-PageSize, result.Count)
+		require.True(result.AtEnd)
+		require.Equal("", result.Cursor)
+		for i := 0; i != result.Count; i++ {
+			require.False(seen[string(result.Result(i).EntityID)])
+			seen[string(result.Result(i).EntityID)] = true
+		}
+		require.Equal(total, len(seen))
+
+		result, err = roost1.NextPage(result)
+		require.Nil(err)
+		require.Equal(0, result.Count)
+		require.True(result.AtEnd)
+
+		_, err = roost1.SearchWithQuery(&SearchQuery{Term: "lawn", Order: order, Cursor: "not a cursor"})
+		require.NotNil(err)
+		total++
+	}
 }
 
-func TestRoostReactionsSetAndUnset(t *testing.T) {
+func TestRoostSearchWithQuery(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -514,22 +2043,55 @@ func TestRoostReactionsSetAndUnset(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
-	require.Equal("hello there", message.Body)
-	require.Equal(topics.Topic(0).ID, message.TopicID)
+	homeID := topics.Topic(0).ID
+	garden, err := group.CreateTopic("garden")
 	require.Nil(err)
-	require.Nil(group.SetReaction(message.ID, "😶‍🌫️", true))
-	require.Nil(group.SetReaction(message.ID, "😅", true))
-	reactions, err := group.Reactions(message.ID)
+	mow, err := group.CreateTodo(homeID, "mow the lawn")
 	require.Nil(err)
-	require.Equal(2, reactions.Count)
-	require.Nil(group.SetReaction(message.ID, "😶‍🌫️", false))
-	reactions, err = group.Reactions(message.ID)
+	_, err = group.CreateTodo(garden.ID, "water the lawn")
 	require.Nil(err)
-	require.Equal(1, reactions.Count)
+	_, err = group.CreateMessage(homeID, "the lawn looks great")
+	require.Nil(err)
+	updater := group.TodoUpdater()
+	updater.MarkComplete(mow.ID, true)
+	require.Nil(updater.Commit())
+	start := now()
+	time.Sleep(10 * time.Millisecond)
+
+	group.group.AuthorTag = [7]byte{1, 2, 3, 4, 5, 6, 7}
+	writer := roost1.slick.EAVWriter(group.group)
+	writer.Insert("messages", map[string]interface{}{
+		"body":     "lawn party tonight",
+		"topic_id": homeID,
+	})
+	require.Nil(writer.Execute())
+
+	bodies := func(query *SearchQuery) []string {
+		results, err := roost1.SearchWithQuery(query)
+		require.Nil(err)
+		require.Equal(results.Count, results.Total)
+		bodies := make([]string, results.Count)
+		for i := 0; i != results.Count; i++ {
+			bodies[i] = results.Result(i).Text
+		}
+		return bodies
+	}
+
+	require.ElementsMatch([]string{"mow the lawn", "water the lawn"}, bodies(&SearchQuery{Term: "lawn", Type: "todo"}))
+	require.ElementsMatch([]string{"water the lawn"}, bodies(&SearchQuery{GroupID: group.GroupID, Term: "lawn", TopicID: garden.ID}))
+	require.ElementsMatch([]string{"lawn party tonight"}, bodies(&SearchQuery{Term: "lawn", AuthorID: []byte{1, 2, 3, 4}}))
+	require.ElementsMatch([]string{"lawn party tonight"}, bodies(&SearchQuery{Term: "lawn", Start: start}))
+	require.ElementsMatch([]string{"mow the lawn", "water the lawn", "the lawn looks great"}, bodies(&SearchQuery{Term: "lawn", End: start}))
+	require.ElementsMatch([]string{"mow the lawn"}, bodies(&SearchQuery{Term: "lawn", Completion: SearchCompletionComplete}))
+	require.ElementsMatch([]string{"water the lawn"}, bodies(&SearchQuery{Term: "lawn", Completion: SearchCompletionIncomplete}))
+	require.Equal([]string{"lawn party tonight", "the lawn looks great", "water the lawn", "mow the lawn"}, bodies(&SearchQuery{Term: "lawn", Order: SearchOrderRecency}))
+	require.Equal([]string{"lawn party tonight", "the lawn looks great"}, bodies(&SearchQuery{Type: "message"}))
+
+	_, err = roost1.SearchWithQuery(&SearchQuery{Term: "lawn", Type: "reaction"})
+	require.NotNil(err)
 }
 
-func TestRoostReactionsTooManyRunes(t *testing.T) {
+func TestRoostSearchUserInput(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -539,15 +2101,39 @@ func TestRoostReactionsTooManyRunes(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	message, err := group.CreateMessage(topics.Topic(0).ID, "hello there")
-	require.Equal("hello there", message.Body)
-	require.Equal(topics.Topic(0).ID, message.TopicID)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	err = group.SetReaction(message.ID, "😶‍🌫️😀", true)
-	require.ErrorContains(err, "got 2")
+	_, err = group.CreateTodo(topics.Topic(0).ID, "fix the lawn mower")
+	require.Nil(err)
+	_, err = group.CreateMessage(topics.Topic(0).ID, "cats and dogs")
+	require.Nil(err)
+
+	for _, input := range []string{`lawn"`, "AND", "OR lawn", "NEAR(", "*", `"`, "lawn -"} {
+		_, err := roost1.Search(group.GroupID, input, "<b>", "</b>")
+		require.Nil(err, input)
+	}
+
+	result, err := roost1.Search(group.GroupID, "mo", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(2, result.Count)
+	result, err = roost1.Search(group.GroupID, "lawn -mower", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	require.Equal("mow the <b>lawn</b>", result.Result(0).Text)
+	result, err = roost1.Search(group.GroupID, `"lawn mower"`, "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	result, err = roost1.Search(group.GroupID, "and", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	require.Equal("cats <b>and</b> dogs", result.Result(0).Text)
+
+	_, err = roost1.Search(group.GroupID, "-lawn", "<b>", "</b>")
+	var queryErr *SearchQueryError
+	require.True(errors.As(err, &queryErr))
 }
 
-func TestExternalInvite(t *testing.T) {
+func TestRoostSearchTokenization(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -557,35 +2143,36 @@ func TestExternalInvite(t *testing.T) {
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "hey there!")
+	_, err = group.CreateTodo(topics.Topic(0).ID, "book a table at the café")
 	require.Nil(err)
-
-	roost2, _, err := makeRoost("roost2")
-	defer teardownRoost(roost2, "roost2")
+	_, err = group.CreateMessage(topics.Topic(0).ID, "Tiếng Việt")
 	require.Nil(err)
-	require.Nil(roost2.Initialize(password))
-
-	invite, err := group.Invite("invite password")
+	_, err = group.CreateMessage(topics.Topic(0).ID, "東京都に住んでいます")
 	require.Nil(err)
-
-	_, err = roost2.AcceptInvite(invite, "invite password")
+	_, err = group.CreateTodo(topics.Topic(0).ID, "明日の天気を確認する")
 	require.Nil(err)
-	require.Eventually(func() bool {
-		groups, err := roost2.Groups()
-		require.Nil(err)
-		return groups.Count == 1
-	}, 10*time.Second, 100*time.Millisecond)
 
-	groups, err := roost2.Groups()
+	result, err := roost1.Search(group.GroupID, "cafe", "<b>", "</b>")
 	require.Nil(err)
-	todos, err := groups.Group(0).Todos(topics.Topic(0).ID)
+	require.Equal(1, result.Count)
+	require.Equal("book a table at the <b>café</b>", result.Result(0).Text)
+	result, err = roost1.Search(group.GroupID, "viet", "<b>", "</b>")
 	require.Nil(err)
-	require.Equal(1, todos.IncompleteCount)
-	require.Equal("hey there!", todos.IncompleteTodo(0).Body)
-	require.Equal(0, todos.CompleteCount)
+	require.Equal(1, result.Count)
+	result, err = roost1.Search(group.GroupID, "京都に", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Count)
+	require.Equal("東<b>京都に</b>住んでいます", result.Result(0).Text)
+	result, err = roost1.Search(group.GroupID, "天気", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(1, result.Total)
+	require.Equal("明日の天気を確認する", result.Result(0).Text)
+	result, err = roost1.Search(group.GroupID, "天気 -明日", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(0, result.Total)
 }
 
-func TestDeviceGroupInvite(t *testing.T) {
+func TestRoostSearchTopics(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
@@ -593,92 +2180,84 @@ func TestDeviceGroupInvite(t *testing.T) {
 	require.Nil(roost1.Initialize(password))
 	group, err := roost1.CreateGroup("group1")
 	require.Nil(err)
-	topics, err := group.Topics()
+	topic, err := group.CreateTopic("garden")
 	require.Nil(err)
-	_, err = group.CreateTodo(topics.Topic(0).ID, "hey there!")
+	_, err = group.CreateTodo(topic.ID, "plant the garden beds")
 	require.Nil(err)
 
-	roost2, _, err := makeRoost("roost2")
-	defer teardownRoost(roost2, "roost2")
+	result, err := roost1.SearchWithQuery(&SearchQuery{GroupID: group.GroupID, Term: "garden", Type: "topic"})
 	require.Nil(err)
-	require.Nil(roost2.Initialize(password))
-
-	require.Nil(roost1.SetDeviceNameType("this is roost1", "Desktop"))
-	require.Nil(roost2.SetDeviceNameType("this is roost2", "iPhone"))
-
-	link, err := roost1.GetDeviceLink()
+	require.Equal(1, result.Count)
+	require.Equal(topic.ID, result.Result(0).EntityID)
+	require.Equal(topic.ID, result.Result(0).TopicID)
+	require.Equal("garden", result.Result(0).TopicName)
+	result, err = roost1.Search(group.GroupID, "garden", "<b>", "</b>")
 	require.Nil(err)
+	require.Equal(2, result.Count)
 
-	require.Nil(roost2.LinkDevice(link))
-
-	require.Eventually(func() bool {
-		devices, err := roost1.Devices()
-		require.Nil(err)
-		return devices.Count == 2
-	}, 2*time.Second, 50*time.Millisecond)
-
-	devices, err := roost1.Devices()
+	require.Nil(group.PinTopic(topic.ID, true))
+	topic.Label = "vegetable patch"
+	require.Nil(group.UpdateTopic(topic))
+	result, err = roost1.SearchWithQuery(&SearchQuery{GroupID: group.GroupID, Term: "garden", Type: "topic"})
 	require.Nil(err)
-
-	require.Equal("this is roost1", devices.Device(0).Name())
-	require.Equal("Desktop", devices.Device(0).Type())
-	require.Equal("this is roost2", devices.Device(1).Name())
-	require.Equal("iPhone", devices.Device(1).Type())
-
-	require.Eventually(func() bool {
-		devices, err := roost2.Devices()
-		require.Nil(err)
-		return devices.Count == 2
-	}, 2*time.Second, 50*time.Millisecond)
-
-	devices, err = roost2.Devices()
+	require.Equal(0, result.Count)
+	result, err = roost1.SearchWithQuery(&SearchQuery{GroupID: group.GroupID, Term: "vegetable", Type: "topic"})
 	require.Nil(err)
+	require.Equal(1, result.Count)
 
-	require.Equal("this is roost1", devices.Device(0).Name())
-	require.Equal("Desktop", devices.Device(0).Type())
-	require.Equal("this is roost2", devices.Device(1).Name())
-	require.Equal("iPhone", devices.Device(1).Type())
-
-	require.Eventually(func() bool {
-		groups, err := roost2.Groups()
-		require.Nil(err)
-		return groups.Count == 1
-	}, 5*time.Second, 100*time.Millisecond)
-
-	groups, err := roost2.Groups()
-	require.Nil(err)
-	todos, err := groups.Group(0).Todos(topics.Topic(0).ID)
+	require.Nil(group.DeleteTopic(topic.ID))
+	result, err = roost1.Search(group.GroupID, "vegetable", "<b>", "</b>")
 	require.Nil(err)
-	require.Equal(1, todos.IncompleteCount)
-	require.Equal("hey there!", todos.IncompleteTodo(0).Body)
+	require.Equal(0, result.Count)
 }
 
-func TestRoostSearchGroup(t *testing.T) {
+func TestRoostVerifyAndRebuildSearchIndex(t *testing.T) {
 	require := require.New(t)
 	roost1, _, err := makeRoost("roost1")
 	defer teardownRoost(roost1, "roost1")
 	require.Nil(err)
 	require.Nil(roost1.Initialize(password))
-	group, err := roost1.CreateGroup("grou1")
+	group, err := roost1.CreateGroup("group1")
 	require.Nil(err)
 	topics, err := group.Topics()
 	require.Nil(err)
-	require.Equal(1, topics.Count)
-	todo1, err := group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
+	todo, err := group.CreateTodo(topics.Topic(0).ID, "mow the lawn")
 	require.Nil(err)
-	require.Equal(float64(0), todo1.CompletedAt)
-	require.Equal(false, todo1.Deleted)
-	todo2, err := group.CreateTodo(topics.Topic(0).ID, "make my bed")
+	message, err := group.CreateMessage(topics.Topic(0).ID, "the lawn looks great")
 	require.Nil(err)
-	require.Equal(float64(0), todo2.CompletedAt)
-	require.Equal(false, todo2.Deleted)
-	require.Greater(todo2.Position, todo1.Position)
+	_, err = group.CreateTodo(topics.Topic(0).ID, "water the lawn")
+	require.Nil(err)
+
+	report, err := roost1.VerifySearchIndex()
+	require.Nil(err)
+	require.True(report.OK())
+
+	require.Nil(roost1.slick.DB.Run("break search index", func() error {
+		_, err := roost1.slick.DB.Tx.Exec(`
+		DELETE FROM fs_contents WHERE entity_id = ?;
+		UPDATE fs_contents SET text = 'mow the grass' WHERE entity_id = ?;
+		INSERT INTO fs_contents (group_id, topic_id, entity_id, type, text) VALUES (?, ?, X'00', 'todo', 'ghost');
+		INSERT INTO fs_content_fts_idx(rowid, text) VALUES (1000, 'phantom');`, message.ID, todo.ID, group.GroupID, topics.Topic(0).ID)
+		return err
+	}))
+	report, err = roost1.VerifySearchIndex()
+	require.Nil(err)
+	require.False(report.OK())
+	require.Equal(1, report.Missing)
+	require.Equal(1, report.Stale)
+	require.Equal(1, report.Mismatched)
+	require.False(report.IndexesConsistent)
 
+	require.Nil(roost1.RebuildSearchIndex())
+	report, err = roost1.VerifySearchIndex()
+	require.Nil(err)
+	require.True(report.OK())
 	result, err := roost1.Search(group.GroupID, "lawn", "<b>", "</b>")
 	require.Nil(err)
-	require.Equal("mow the <b>lawn</b>", result.Result(0).Text)
-	require.Equal(todo1.ID, result.Result(0).EntityID)
-	require.Equal("todo", result.Result(0).Type)
+	require.Equal(3, result.Total)
+	result, err = roost1.Search(group.GroupID, "phantom", "<b>", "</b>")
+	require.Nil(err)
+	require.Equal(0, result.Total)
 }
 
 func TestRoostUnreadMessageCounts(t *testing.T) {
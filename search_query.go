@@ -0,0 +1,167 @@
+package roost
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An error returned when text entered by a user cannot be turned into a search.
+type SearchQueryError struct {
+	Query  string
+	Reason string
+}
+
+func (e *SearchQueryError) Error() string {
+	return fmt.Sprintf("invalid search query %q: %s", e.Query, e.Reason)
+}
+
+type searchTerm struct {
+	text    string
+	phrase  bool
+	exclude bool
+	prefix  bool
+}
+
+// A search for text entered by a user.
+type userSearch struct {
+	included []*searchTerm
+	excluded []*searchTerm
+}
+
+// The trigram tokenizer only matches substrings of at least this many characters.
+const minTrigramLength = 3
+
+// Parses free-form text entered by a user. Words must all match, "quoted phrases" must match exactly and words or
+// phrases starting with - must not match. As the user is likely still typing, the last word matches as a prefix
+// unless it is followed by a space. Everything else, including FTS5 operators such as AND, is matched literally.
+// Returns nil if there is nothing to search for.
+func parseUserSearch(input string) (*userSearch, error) {
+	terms := splitSearchTerms(input)
+	if len(terms) != 0 && strings.TrimRightFunc(input, unicode.IsSpace) == input {
+		last := terms[len(terms)-1]
+		last.prefix = !last.phrase && !last.exclude
+	}
+
+	us := &userSearch{}
+	for _, term := range terms {
+		if strings.IndexFunc(term.text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) == -1 {
+			// fts5 discards punctuation, so a term without letters or numbers would never match
+			continue
+		}
+		if term.exclude {
+			us.excluded = append(us.excluded, term)
+		} else {
+			us.included = append(us.included, term)
+		}
+	}
+
+	if len(us.included) == 0 {
+		if len(us.excluded) != 0 {
+			return nil, &SearchQueryError{input, "expected something to search for besides excluded terms"}
+		}
+		return nil, nil
+	}
+	return us, nil
+}
+
+// Gets the FTS5 query for the word index.
+func (us *userSearch) wordQuery() string {
+	return us.query(true)
+}
+
+// Gets the FTS5 query for the trigram index, which matches terms anywhere within the text. Returns false if a term
+// is too short to be found using the trigram index.
+func (us *userSearch) trigramQuery() (string, bool) {
+	for _, term := range append(us.included, us.excluded...) {
+		if utf8.RuneCountInString(term.text) < minTrigramLength {
+			return "", false
+		}
+	}
+	return us.query(false), true
+}
+
+func (us *userSearch) query(prefix bool) string {
+	quote := func(terms []*searchTerm) []string {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term.text, `"`, `""`) + `"`
+			if prefix && term.prefix {
+				quoted[i] += "*"
+			}
+		}
+		return quoted
+	}
+	query := strings.Join(quote(us.included), " ")
+	if len(us.excluded) != 0 {
+		query = "(" + query + ") NOT " + strings.Join(quote(us.excluded), " NOT ")
+	}
+	return query
+}
+
+// Gets LIKE conditions on the given column which match the terms anywhere within the text. This is used when a term
+// is too short for the trigram index and has to scan every row.
+func (us *userSearch) likeConditions(column string) ([]string, []interface{}) {
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	conditions := make([]string, 0, len(us.included)+len(us.excluded))
+	args := make([]interface{}, 0, len(us.included)+len(us.excluded))
+	for _, term := range us.included {
+		conditions = append(conditions, column+` LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escaper.Replace(term.text)+"%")
+	}
+	for _, term := range us.excluded {
+		conditions = append(conditions, column+` NOT LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escaper.Replace(term.text)+"%")
+	}
+	return conditions, args
+}
+
+// Returns true if any term is written in a script which doesn't separate words with spaces, such as Chinese or
+// Japanese. The word index treats a whole run of such text as a single word, so these are searched for using
+// the trigram index instead.
+func (us *userSearch) unsegmented() bool {
+	for _, term := range append(us.included, us.excluded...) {
+		if strings.IndexFunc(term.text, func(r rune) bool {
+			return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+		}) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits user input into words and phrases. An unterminated quote runs to the end of the input.
+func splitSearchTerms(input string) []*searchTerm {
+	terms := make([]*searchTerm, 0)
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		term := &searchTerm{}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			term.exclude = true
+			i++
+		}
+		if runes[i] == '"' {
+			term.phrase = true
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			term.text = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			term.text = string(runes[i:end])
+			i = end
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
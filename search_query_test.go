@@ -0,0 +1,76 @@
+package roost
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUserSearch(t *testing.T) {
+	require := require.New(t)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"lawn", `"lawn"*`},
+		{"lawn ", `"lawn"`},
+		{"mow the la", `"mow" "the" "la"*`},
+		{`foo"`, `"foo"""*`},
+		{"AND", `"AND"*`},
+		{"cats OR dogs NOT", `"cats" "OR" "dogs" "NOT"*`},
+		{"NEAR(a b)", `"NEAR(a" "b)"*`},
+		{`"mow the lawn"`, `"mow the lawn"`},
+		{`"mow the lawn" soon`, `"mow the lawn" "soon"*`},
+		{`"mow the`, `"mow the"`},
+		{"lawn -mower", `("lawn") NOT "mower"`},
+		{`lawn -"push mower" -weeds`, `("lawn") NOT "push mower" NOT "weeds"`},
+		{"lawn - mower", `"lawn" "mower"*`},
+		{"lawn & *", `"lawn"`},
+		{"café", `"café"*`},
+	}
+	for _, test := range tests {
+		search, err := parseUserSearch(test.input)
+		require.Nil(err, test.input)
+		if test.expected == "" {
+			require.Nil(search, test.input)
+			continue
+		}
+		require.Equal(test.expected, search.wordQuery(), test.input)
+	}
+}
+
+func TestParseUserSearchOnlyExcluded(t *testing.T) {
+	require := require.New(t)
+	_, err := parseUserSearch("-mower -weeds")
+	var queryErr *SearchQueryError
+	require.True(errors.As(err, &queryErr))
+	require.Equal("-mower -weeds", queryErr.Query)
+}
+
+func TestUserSearchUnsegmented(t *testing.T) {
+	require := require.New(t)
+	search, err := parseUserSearch("東京都 -大阪府")
+	require.Nil(err)
+	require.True(search.unsegmented())
+	query, ok := search.trigramQuery()
+	require.True(ok)
+	require.Equal(`("東京都") NOT "大阪府"`, query)
+
+	search, err = parseUserSearch("天気")
+	require.Nil(err)
+	require.True(search.unsegmented())
+	_, ok = search.trigramQuery()
+	require.False(ok)
+	conditions, args := search.likeConditions("c.text")
+	require.Equal([]string{`c.text LIKE ? ESCAPE '\'`}, conditions)
+	require.Equal([]interface{}{"%天気%"}, args)
+
+	search, err = parseUserSearch("100% -a_b")
+	require.Nil(err)
+	require.False(search.unsegmented())
+	_, args = search.likeConditions("c.text")
+	require.Equal([]interface{}{`%100\%%`, `%a\_b%`}, args)
+}